@@ -0,0 +1,358 @@
+package armor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// Armor is an application runtime that owns its context, logger and configuration. Several instances can
+// coexist in one process, e.g. when integration tests start multiple services.
+type Armor struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	isRelease bool
+	logger    *zap.Logger
+	config    util.Configuration
+	report    util.ConfigReport
+
+	shutdownTimeout time.Duration
+	mu              sync.Mutex
+	hooks           []shutdownHook
+	shutdownOnce    sync.Once
+	shutdownErr     error
+}
+
+// ShutdownHook releases a resource, such as an HTTP server or database pool, when an Armor instance shuts down.
+// It should return promptly once ctx is done.
+type ShutdownHook func(ctx context.Context) error
+
+type shutdownHook struct {
+	name string
+	fn   ShutdownHook
+}
+
+// DefaultShutdownTimeout is how long Shutdown waits for shutdown hooks. Cloud Run allows 10 seconds after SIGTERM,
+// which leaves time to flush the logger.
+const DefaultShutdownTimeout = 8 * time.Second
+
+// Option configures an Armor instance created by New.
+type Option func(*options)
+
+type options struct {
+	ctx             context.Context
+	signals         []os.Signal
+	shutdownTimeout time.Duration
+	isRelease       bool
+	minLevel        zapcore.Level
+	logger          *zap.Logger
+	config          util.Configuration
+	configPath      string
+	layered         *util.LayeredOptions
+	secretSource    util.SecretSource
+}
+
+// WithContext sets the context returned by Armor.Context. Defaults to context.Background().
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithSignals cancels the instance's context when any of the signals is received, e.g. syscall.SIGTERM from
+// Cloud Run. Use Wait to block until then and shut down. A second signal terminates the process as usual.
+func WithSignals(signals ...os.Signal) Option {
+	return func(o *options) {
+		o.signals = signals
+	}
+}
+
+// WithShutdownTimeout sets how long Shutdown waits for shutdown hooks. Defaults to DefaultShutdownTimeout.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.shutdownTimeout = timeout
+	}
+}
+
+// WithRelease selects release mode: JSON logging for Cloud Run, and configuration from environment variables
+// rather than a file when using WithConfiguration.
+func WithRelease(isRelease bool) Option {
+	return func(o *options) {
+		o.isRelease = isRelease
+	}
+}
+
+// WithLogLevel sets the minimum level of the logger created by New. Defaults to zapcore.InfoLevel.
+func WithLogLevel(minLevel zapcore.Level) Option {
+	return func(o *options) {
+		o.minLevel = minLevel
+	}
+}
+
+// WithLogger uses logger instead of creating one.
+func WithLogger(logger *zap.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithConfiguration loads config as InitArmor does: from environment variables in release mode, otherwise from
+// the file at configPath.
+func WithConfiguration(config util.Configuration, configPath string) Option {
+	return func(o *options) {
+		o.config = config
+		o.configPath = configPath
+		o.layered = nil
+	}
+}
+
+// WithLayeredConfiguration loads config from defaults, files, environment variables and flags
+// (see util.LoadLayeredConfiguration).
+func WithLayeredConfiguration(config util.Configuration, layered util.LayeredOptions) Option {
+	return func(o *options) {
+		o.config = config
+		o.configPath = ""
+		o.layered = &layered
+	}
+}
+
+// WithSecretSource resolves configuration fields tagged with a secret reference (see util.LoadSecrets).
+func WithSecretSource(source util.SecretSource) Option {
+	return func(o *options) {
+		o.secretSource = source
+	}
+}
+
+// New creates an Armor instance.
+//
+// Parameters:
+//   - opts: Options selecting the release mode, logger and configuration. Without a configuration option, no
+//     configuration is loaded.
+//
+// Returns:
+//   - A pointer to the Armor instance. Call Close when it is no longer needed.
+//   - An error if there's an issue loading or validating the configuration.
+func New(opts ...Option) (*Armor, error) {
+	o := options{
+		ctx:             context.Background(),
+		minLevel:        zapcore.InfoLevel,
+		shutdownTimeout: DefaultShutdownTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	a := &Armor{
+		isRelease:       o.isRelease,
+		logger:          o.logger,
+		config:          o.config,
+		shutdownTimeout: o.shutdownTimeout,
+	}
+
+	if a.logger == nil {
+		a.logger = util.NewLogger(o.isRelease, o.minLevel)
+	}
+
+	if err := a.loadConfiguration(o); err != nil {
+		return nil, err
+	}
+
+	a.ctx, a.cancel = context.WithCancel(o.ctx)
+	if len(o.signals) > 0 {
+		ctx, stop := signal.NotifyContext(a.ctx, o.signals...)
+		a.ctx = ctx
+
+		// Restore the default behaviour once the first signal arrives, so that a second one terminates the
+		// process even if shutdown hangs.
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+	}
+
+	return a, nil
+}
+
+func (a *Armor) loadConfiguration(o options) error {
+	if o.config == nil {
+		return nil
+	}
+
+	if o.layered != nil {
+		layered := *o.layered
+		if layered.Secrets == nil {
+			layered.Secrets = o.secretSource
+		}
+
+		report, err := util.LoadLayeredConfiguration(o.config, layered)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		a.report = report
+	} else {
+		if o.secretSource != nil {
+			if err := util.LoadSecrets(o.ctx, o.config, o.secretSource); err != nil {
+				return fmt.Errorf("failed to load secrets: %w", err)
+			}
+		}
+
+		if o.isRelease {
+			if err := util.LoadEnvironmentVariables(o.config); err != nil {
+				return fmt.Errorf("failed to load environment variables: %w", err)
+			}
+		} else {
+			if err := util.LoadConfiguration(o.configPath, o.config); err != nil {
+				return fmt.Errorf("failed to load configuration file: %w", err)
+			}
+		}
+	}
+
+	a.logger.Info(fmt.Sprintf("[ARMOR]: Loaded configuration: %s", util.RedactConfiguration(o.config)))
+	if a.report != nil {
+		a.logger.Debug(fmt.Sprintf("[ARMOR]: Configuration sources:\n%s", a.report))
+	}
+
+	return nil
+}
+
+// Context returns the instance's context, which is cancelled when Shutdown starts or a signal registered with
+// WithSignals is received.
+func (a *Armor) Context() context.Context {
+	return a.ctx
+}
+
+// IsRelease reports whether the instance runs in release mode.
+func (a *Armor) IsRelease() bool {
+	return a.isRelease
+}
+
+// Logger returns the instance's logger.
+func (a *Armor) Logger() *zap.Logger {
+	return a.logger
+}
+
+// SugaredLogger returns the instance's logger with printf-style methods.
+func (a *Armor) SugaredLogger() *zap.SugaredLogger {
+	return a.logger.Sugar()
+}
+
+// Config returns the configuration loaded by New, or nil if none was configured.
+func (a *Armor) Config() util.Configuration {
+	return a.config
+}
+
+// ConfigReport returns which layer provided each configuration field when WithLayeredConfiguration is used,
+// otherwise nil.
+func (a *Armor) ConfigReport() util.ConfigReport {
+	return a.report
+}
+
+// OnShutdown registers a hook to run during Shutdown. Hooks run in the reverse order of registration, so
+// resources are released before the resources they depend on. Hooks registered once Shutdown has started
+// are not run.
+func (a *Armor) OnShutdown(name string, hook ShutdownHook) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.hooks = append(a.hooks, shutdownHook{name: name, fn: hook})
+}
+
+// Wait blocks until the instance's context is cancelled, e.g. by a signal registered with WithSignals, and
+// then shuts the instance down.
+//
+// Returns:
+//   - The result of Shutdown.
+func (a *Armor) Wait() error {
+	<-a.ctx.Done()
+	a.logger.Info("[ARMOR]: Shutting down")
+
+	return a.Shutdown(context.Background())
+}
+
+// Shutdown cancels the instance's context, runs the shutdown hooks in reverse order and flushes the logger last.
+// Only the first call has any effect; later calls return its result.
+//
+// Parameters:
+//   - ctx: Bounds the shutdown together with the shutdown timeout, whichever ends first.
+//
+// Returns:
+//   - An error joining the failure of every hook, any hooks skipped because the deadline passed, and any
+//     failure to flush the logger.
+func (a *Armor) Shutdown(ctx context.Context) error {
+	a.shutdownOnce.Do(func() {
+		a.shutdownErr = a.shutdown(ctx)
+	})
+
+	return a.shutdownErr
+}
+
+// Close shuts the instance down, as with Shutdown.
+func (a *Armor) Close() error {
+	return a.Shutdown(context.Background())
+}
+
+func (a *Armor) shutdown(ctx context.Context) error {
+	a.cancel()
+
+	ctx, cancel := context.WithTimeout(ctx, a.shutdownTimeout)
+	defer cancel()
+
+	a.mu.Lock()
+	hooks := a.hooks
+	a.hooks = nil
+	a.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hook := hooks[i]
+		if ctx.Err() != nil {
+			a.logger.Warn(fmt.Sprintf("[ARMOR]: Skipping shutdown hook %s: %v", hook.name, ctx.Err()))
+			errs = append(errs, fmt.Errorf("shutdown hook %s skipped: %w", hook.name, ctx.Err()))
+			continue
+		}
+
+		if err := runShutdownHook(ctx, hook.fn); err != nil {
+			a.logger.Error(fmt.Sprintf("[ARMOR]: Shutdown hook %s failed: %v", hook.name, err))
+			errs = append(errs, fmt.Errorf("shutdown hook %s: %w", hook.name, err))
+		}
+	}
+
+	if err := util.SyncLogger(a.logger); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// runShutdownHook runs hook, returning early if ctx is done before it returns.
+func runShutdownHook(ctx context.Context, hook ShutdownHook) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- hook(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ConfigAs returns the configuration of a as T, e.g. armor.ConfigAs[*AppConfig](a).
+func ConfigAs[T util.Configuration](a *Armor) (T, bool) {
+	config, ok := a.config.(T)
+	return config, ok
+}
@@ -0,0 +1,83 @@
+package gcptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jwk"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jws"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+// IAP is a fake of Identity-Aware Proxy. It publishes a JSON Web Key Set at CertsURL and signs ES256
+// assertions the way IAP does: without an "email_verified" claim.
+type IAP struct {
+	Server *httptest.Server
+
+	keyID      string
+	privateKey *ecdsa.PrivateKey
+}
+
+// NewIAP starts a fake Identity-Aware Proxy with a freshly generated P-256 signing key. Call Close when done.
+func NewIAP() (*IAP, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, err := common.NewJwtID()
+	if err != nil {
+		return nil, err
+	}
+
+	i := &IAP{keyID: keyID, privateKey: privateKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/public_key-jwk", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(jwk.Set{Keys: []jwk.Key{jwk.NewECKey(keyID, string(common.ES256), &privateKey.PublicKey)}})
+	})
+	i.Server = httptest.NewServer(mux)
+
+	return i, nil
+}
+
+// CertsURL returns the URL of the fake's JSON Web Key Set.
+func (i *IAP) CertsURL() string {
+	return i.Server.URL + "/public_key-jwk"
+}
+
+// Close shuts down the server.
+func (i *IAP) Close() {
+	i.Server.Close()
+}
+
+// Claims returns a valid set of IAP assertion claims for audience and the signed-in user's email.
+// Callers can add or override claims before passing them to Sign.
+func (i *IAP) Claims(audience string, email string) common.ClaimSet {
+	now := time.Now()
+	return common.ClaimSet{
+		string(common.Issuer):         "https://cloud.google.com/iap",
+		string(common.Subject):        "accounts.google.com:100000000000000000000",
+		string(common.Audience):       audience,
+		string(common.IssuedAt):       now.Unix(),
+		string(common.ExpirationTime): now.Add(10 * time.Minute).Unix(),
+		"email":                       email,
+		"hd":                          "example.com",
+	}
+}
+
+// Sign signs claims as an ES256 IAP assertion.
+func (i *IAP) Sign(claims common.ClaimSet) (string, error) {
+	token, err := jws.NewWithSigner(common.ES256, claims, i.privateKey)
+	if err != nil {
+		return "", err
+	}
+	token.Header.Data["kid"] = i.keyID
+
+	return token.Encode()
+}
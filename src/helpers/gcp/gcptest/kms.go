@@ -0,0 +1,96 @@
+package gcptest
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sync"
+)
+
+// KMS is an in-memory fake of Cloud KMS implementing gcp.KMSClient, backed by software keys.
+type KMS struct {
+	mu    sync.Mutex
+	keys  map[string]crypto.Signer
+	calls map[string]int
+}
+
+// NewKMS creates an empty fake KMS.
+func NewKMS() *KMS {
+	return &KMS{
+		keys:  map[string]crypto.Signer{},
+		calls: map[string]int{},
+	}
+}
+
+// AddKey registers a private key (*rsa.PrivateKey or *ecdsa.PrivateKey) under the key version name.
+func (k *KMS) AddKey(keyVersion string, key crypto.Signer) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[keyVersion] = key
+}
+
+// Calls returns how many sign and decrypt operations have been performed with the key version.
+func (k *KMS) Calls(keyVersion string) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.calls[keyVersion]
+}
+
+func (k *KMS) key(keyVersion string, count bool) (crypto.Signer, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, found := k.keys[keyVersion]
+	if !found {
+		return nil, fmt.Errorf("key version %s not found", keyVersion)
+	}
+
+	if count {
+		k.calls[keyVersion]++
+	}
+
+	return key, nil
+}
+
+func (k *KMS) GetPublicKey(_ context.Context, keyVersion string) ([]byte, error) {
+	key, err := k.key(keyVersion, false)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+func (k *KMS) AsymmetricSign(_ context.Context, keyVersion string, digest []byte) ([]byte, error) {
+	key, err := k.key(keyVersion, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return key.Sign(rand.Reader, digest, crypto.SHA256)
+}
+
+func (k *KMS) AsymmetricDecrypt(_ context.Context, keyVersion string, ciphertext []byte) ([]byte, error) {
+	key, err := k.key(keyVersion, true)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key version %s is not a decryption key", keyVersion)
+	}
+
+	return rsa.DecryptOAEP(crypto.SHA256.New(), rand.Reader, rsaKey, ciphertext, nil)
+}
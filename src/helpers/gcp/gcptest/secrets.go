@@ -0,0 +1,70 @@
+package gcptest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// SecretManager is an in-memory fake of Secret Manager implementing util.SecretSource.
+// A version name ending in "/versions/latest" resolves to the most recently added version.
+type SecretManager struct {
+	mu       sync.Mutex
+	versions map[string][]string
+	accessed map[string]int
+}
+
+// NewSecretManager creates an empty fake Secret Manager.
+func NewSecretManager() *SecretManager {
+	return &SecretManager{
+		versions: map[string][]string{},
+		accessed: map[string]int{},
+	}
+}
+
+// AddVersion adds a new version to the secret (e.g. projects/p/secrets/db-password) and returns its name.
+func (s *SecretManager) AddVersion(secret string, value string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.versions[secret] = append(s.versions[secret], value)
+
+	return fmt.Sprintf("%s/versions/%d", secret, len(s.versions[secret]))
+}
+
+// Accessed returns how many times the secret version name has been accessed.
+func (s *SecretManager) Accessed(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.accessed[name]
+}
+
+func (s *SecretManager) AccessSecret(_ context.Context, name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accessed[name]++
+
+	secret, version, found := strings.Cut(name, "/versions/")
+	if !found {
+		return nil, fmt.Errorf("invalid secret version name: %s", name)
+	}
+
+	versions := s.versions[secret]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("secret %s not found", secret)
+	}
+
+	if version == "latest" {
+		return []byte(versions[len(versions)-1]), nil
+	}
+
+	var index int
+	if _, err := fmt.Sscanf(version, "%d", &index); err != nil || index < 1 || index > len(versions) {
+		return nil, fmt.Errorf("secret version %s not found", name)
+	}
+
+	return []byte(versions[index-1]), nil
+}
@@ -0,0 +1,150 @@
+package gcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+	"io"
+	"time"
+)
+
+// kmsTimeout bounds each Cloud KMS call made through the crypto.Signer and crypto.Decrypter interfaces,
+// which do not accept a context.
+const kmsTimeout = 10 * time.Second
+
+// KMSClient is the subset of Cloud KMS used by KMSKey. Tests can substitute a local fake.
+type KMSClient interface {
+	// GetPublicKey returns the PEM-encoded public key of the key version.
+	GetPublicKey(ctx context.Context, keyVersion string) ([]byte, error)
+
+	// AsymmetricSign signs a SHA-256 digest with the key version.
+	AsymmetricSign(ctx context.Context, keyVersion string, digest []byte) ([]byte, error)
+
+	// AsymmetricDecrypt decrypts RSA-OAEP ciphertext with the key version.
+	AsymmetricDecrypt(ctx context.Context, keyVersion string, ciphertext []byte) ([]byte, error)
+}
+
+// NewKMSClient creates a KMSClient backed by the Cloud KMS API using Application Default Credentials.
+func NewKMSClient(ctx context.Context, opts ...option.ClientOption) (KMSClient, error) {
+	service, err := cloudkms.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cloud kms client: %w", err)
+	}
+
+	return &cloudKMSClient{versions: service.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions}, nil
+}
+
+type cloudKMSClient struct {
+	versions *cloudkms.ProjectsLocationsKeyRingsCryptoKeysCryptoKeyVersionsService
+}
+
+func (c *cloudKMSClient) GetPublicKey(ctx context.Context, keyVersion string) ([]byte, error) {
+	resp, err := c.versions.GetPublicKey(keyVersion).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(resp.Pem), nil
+}
+
+func (c *cloudKMSClient) AsymmetricSign(ctx context.Context, keyVersion string, digest []byte) ([]byte, error) {
+	req := &cloudkms.AsymmetricSignRequest{
+		Digest: &cloudkms.Digest{Sha256: base64.StdEncoding.EncodeToString(digest)},
+	}
+
+	resp, err := c.versions.AsymmetricSign(keyVersion, req).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(resp.Signature)
+}
+
+func (c *cloudKMSClient) AsymmetricDecrypt(ctx context.Context, keyVersion string, ciphertext []byte) ([]byte, error) {
+	req := &cloudkms.AsymmetricDecryptRequest{
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	}
+
+	resp, err := c.versions.AsymmetricDecrypt(keyVersion, req).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(resp.Plaintext)
+}
+
+// KMSKey is a Cloud KMS asymmetric key version usable wherever a crypto.Signer or crypto.Decrypter is
+// accepted, e.g. TokenBuilder.WithSigner and TokenBuilder.WithDecrypter. The private key never leaves KMS.
+//
+// Signing keys must use a SHA-256 algorithm (RSA_SIGN_PKCS1_*_SHA256 for RS256, EC_SIGN_P256_SHA256 for ES256).
+// Decryption keys must use RSA_DECRYPT_OAEP_*_SHA256.
+type KMSKey struct {
+	client     KMSClient
+	keyVersion string
+	publicKey  crypto.PublicKey
+}
+
+// NewKMSKey loads the public key of keyVersion, e.g.
+// projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1.
+func NewKMSKey(ctx context.Context, client KMSClient, keyVersion string) (*KMSKey, error) {
+	publicKeyPem, err := client.GetPublicKey(ctx, keyVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key for %s: %w", keyVersion, err)
+	}
+
+	block, _ := pem.Decode(publicKeyPem)
+	if block == nil {
+		return nil, errors.New("failed to parse PEM block containing the public key")
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key for %s: %w", keyVersion, err)
+	}
+
+	return &KMSKey{
+		client:     client,
+		keyVersion: keyVersion,
+		publicKey:  publicKey,
+	}, nil
+}
+
+// Public returns the public key of the key version.
+func (k *KMSKey) Public() crypto.PublicKey {
+	return k.publicKey
+}
+
+// Sign signs a SHA-256 digest in Cloud KMS. rand is ignored.
+func (k *KMSKey) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("unsupported hash for KMS signing: %v", opts.HashFunc())
+	}
+
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("RSA-PSS signing is not supported")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kmsTimeout)
+	defer cancel()
+
+	return k.client.AsymmetricSign(ctx, k.keyVersion, digest)
+}
+
+// Decrypt decrypts RSA-OAEP (SHA-256) ciphertext in Cloud KMS. rand is ignored.
+func (k *KMSKey) Decrypt(_ io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	if oaep, ok := opts.(*rsa.OAEPOptions); !ok || oaep.Hash != crypto.SHA256 || len(oaep.Label) > 0 {
+		return nil, errors.New("KMS decryption requires RSA-OAEP with SHA-256 and no label")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kmsTimeout)
+	defer cancel()
+
+	return k.client.AsymmetricDecrypt(ctx, k.keyVersion, ciphertext)
+}
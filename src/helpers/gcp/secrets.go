@@ -0,0 +1,40 @@
+package gcp
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"google.golang.org/api/option"
+	"google.golang.org/api/secretmanager/v1"
+)
+
+// SecretManagerSource resolves Secret Manager secret versions for util.LoadSecrets and armor.SecretSource.
+type SecretManagerSource struct {
+	service *secretmanager.Service
+}
+
+// NewSecretManagerSource creates a SecretManagerSource using Application Default Credentials.
+// Additional client options (e.g. option.WithEndpoint for an emulator) can be supplied.
+func NewSecretManagerSource(ctx context.Context, opts ...option.ClientOption) (*SecretManagerSource, error) {
+	service, err := secretmanager.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secret manager client: %w", err)
+	}
+
+	return &SecretManagerSource{service: service}, nil
+}
+
+// AccessSecret returns the payload of the secret version name, e.g.
+// projects/my-project/secrets/db-password/versions/latest.
+func (s *SecretManagerSource) AccessSecret(ctx context.Context, name string) ([]byte, error) {
+	resp, err := s.service.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Payload == nil {
+		return nil, fmt.Errorf("secret %s has no payload", name)
+	}
+
+	return base64.StdEncoding.DecodeString(resp.Payload.Data)
+}
@@ -3,13 +3,13 @@ package gcp
 import (
 	"context"
 	"github.com/bmwadforth-com/armor-go/src/util"
-	"google.golang.org/api/idtoken"
 )
 
 // GetIdentityToken retrieves an identity token from GCP.
+// Token sources are cached per audience, so repeated calls reuse the same token until shortly before it expires.
 // Read more about ID tokens here: https://cloud.google.com/docs/authentication/get-id-token
 func GetIdentityToken(ctx context.Context, audience string) (string, error) {
-	ts, err := idtoken.NewTokenSource(ctx, audience)
+	ts, err := defaultIdentityTokenCache.Load().TokenSource(ctx, audience)
 	if err != nil {
 		util.LogError("failed to create token source: %v", err)
 		return "", err
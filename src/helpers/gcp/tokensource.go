@@ -0,0 +1,195 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jws"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/idtoken"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MetadataHostEnv overrides the metadata server host, as with Google's client libraries.
+	MetadataHostEnv = "GCE_METADATA_HOST"
+	// defaultMetadataHost is the link-local address of the GCE / Cloud Run metadata server.
+	defaultMetadataHost = "169.254.169.254"
+	// defaultEarlyExpiry is how long before expiry a cached identity token is refreshed.
+	defaultEarlyExpiry = 5 * time.Minute
+)
+
+// TokenSourceFunc creates a token source that mints identity tokens for audience.
+type TokenSourceFunc func(ctx context.Context, audience string) (oauth2.TokenSource, error)
+
+// IdentityTokenCache keeps one auto-refreshing identity token source per audience, so that
+// tokens are reused until shortly before they expire instead of being minted on every call.
+type IdentityTokenCache struct {
+	newSource   TokenSourceFunc
+	earlyExpiry time.Duration
+
+	mu      sync.Mutex
+	sources map[string]oauth2.TokenSource
+}
+
+// defaultIdentityTokenCache holds the cache used by GetIdentityToken and NewAuthenticatedClient. It is replaced
+// by SetIdentityTokenSource, possibly while other goroutines read it.
+var defaultIdentityTokenCache atomic.Pointer[IdentityTokenCache]
+
+func init() {
+	defaultIdentityTokenCache.Store(NewIdentityTokenCache(nil))
+}
+
+// NewIdentityTokenCache creates an IdentityTokenCache. A nil newSource uses idtoken.NewTokenSource,
+// which reads Application Default Credentials or the metadata server.
+func NewIdentityTokenCache(newSource TokenSourceFunc) *IdentityTokenCache {
+	if newSource == nil {
+		newSource = func(ctx context.Context, audience string) (oauth2.TokenSource, error) {
+			return idtoken.NewTokenSource(ctx, audience)
+		}
+	}
+
+	return &IdentityTokenCache{
+		newSource:   newSource,
+		earlyExpiry: defaultEarlyExpiry,
+		sources:     map[string]oauth2.TokenSource{},
+	}
+}
+
+// TokenSource returns the cached token source for audience, creating it on first use.
+// The source outlives ctx and is shared by later callers, so it is created with ctx's values but without its
+// cancellation or deadline; cancelling a request context does not break later refreshes.
+func (c *IdentityTokenCache) TokenSource(ctx context.Context, audience string) (oauth2.TokenSource, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ts, found := c.sources[audience]; found {
+		return ts, nil
+	}
+
+	ts, err := c.newSource(context.WithoutCancel(ctx), audience)
+	if err != nil {
+		return nil, err
+	}
+
+	ts = oauth2.ReuseTokenSourceWithExpiry(nil, ts, c.earlyExpiry)
+	c.sources[audience] = ts
+
+	return ts, nil
+}
+
+// Token returns a valid identity token for audience, refreshing it if it is about to expire.
+func (c *IdentityTokenCache) Token(ctx context.Context, audience string) (string, error) {
+	ts, err := c.TokenSource(ctx, audience)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := ts.Token()
+	if err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
+
+// Client returns an *http.Client that sends an identity token for audience as a bearer token on
+// every request. A nil base uses http.DefaultTransport.
+func (c *IdentityTokenCache) Client(ctx context.Context, audience string, base http.RoundTripper) (*http.Client, error) {
+	ts, err := c.TokenSource(ctx, audience)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: ts,
+			Base:   base,
+		},
+	}, nil
+}
+
+// SetIdentityTokenSource replaces the token source used by GetIdentityToken and NewAuthenticatedClient,
+// discarding any cached tokens. Pass NewMetadataTokenSource to use the metadata server directly.
+func SetIdentityTokenSource(newSource TokenSourceFunc) {
+	defaultIdentityTokenCache.Store(NewIdentityTokenCache(newSource))
+}
+
+// NewAuthenticatedClient returns an *http.Client that authenticates requests to audience (e.g. another
+// Cloud Run service) with a cached identity token.
+func NewAuthenticatedClient(ctx context.Context, audience string) (*http.Client, error) {
+	return defaultIdentityTokenCache.Load().Client(ctx, audience, nil)
+}
+
+// NewMetadataTokenSource returns a token source that fetches identity tokens for audience directly
+// from the metadata server. The host is read from GCE_METADATA_HOST, so it can be pointed at a fake.
+func NewMetadataTokenSource(_ context.Context, audience string) (oauth2.TokenSource, error) {
+	host := os.Getenv(MetadataHostEnv)
+	if host == "" {
+		host = defaultMetadataHost
+	}
+
+	return &metadataTokenSource{
+		audience: audience,
+		host:     host,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+type metadataTokenSource struct {
+	audience string
+	host     string
+	client   *http.Client
+}
+
+func (s *metadataTokenSource) Token() (*oauth2.Token, error) {
+	endpoint := fmt.Sprintf("http://%s/computeMetadata/v1/instance/service-accounts/default/identity?audience=%s&format=full",
+		s.host, url.QueryEscape(s.audience))
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch identity token from metadata server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata server returned %s: %s", resp.Status, body)
+	}
+
+	tokenString := strings.TrimSpace(string(body))
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("metadata server returned a malformed identity token")
+	}
+
+	token := new(jws.Token)
+	if err := token.Decode(parts); err != nil {
+		return nil, fmt.Errorf("failed to decode identity token: %w", err)
+	}
+
+	expiry, _ := token.Payload.Data.ExpiresAt()
+
+	return &oauth2.Token{
+		AccessToken: tokenString,
+		TokenType:   "Bearer",
+		Expiry:      expiry,
+	}, nil
+}
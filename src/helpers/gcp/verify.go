@@ -0,0 +1,267 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/helpers"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jwk"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jws"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// GoogleCertsURL serves the keys Google signs ID tokens with (Cloud Run, Cloud Tasks, Pub/Sub push, etc.).
+	GoogleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+	// IAPCertsURL serves the keys Identity-Aware Proxy signs its assertions with.
+	IAPCertsURL = "https://www.gstatic.com/iap/verify/public_key-jwk"
+	// IAPIssuer is the issuer of Identity-Aware Proxy assertions.
+	IAPIssuer = "https://cloud.google.com/iap"
+	// IAPAssertionHeader is the request header Identity-Aware Proxy places its signed assertion in.
+	IAPAssertionHeader = "X-Goog-IAP-JWT-Assertion"
+
+	emailClaim         = "email"
+	emailVerifiedClaim = "email_verified"
+)
+
+// GoogleIssuers are the issuers of Google-signed ID tokens.
+var GoogleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
+// IdentityTokenConfig configures an IdentityTokenVerifier.
+type IdentityTokenConfig struct {
+	// Audience is the expected "aud" claim, e.g. the Cloud Run service URL or the Pub/Sub push audience.
+	Audience string
+	// AllowedEmails restricts the caller to these service account (or, for IAP, user) emails. The token's
+	// email must also be verified, except in IAP assertions, which carry no "email_verified" claim because IAP
+	// only asserts Google-verified identities. Leave empty to accept any caller.
+	AllowedEmails []string
+	// CertsURL is the JSON Web Key Set the token signature is checked against. Defaults to GoogleCertsURL.
+	CertsURL string
+	// Issuers are the accepted "iss" claims. Defaults to GoogleIssuers.
+	Issuers []string
+	// Algorithms are the accepted signing algorithms. Defaults to RS256.
+	Algorithms []common.AlgorithmType
+	// HTTPClient is used to fetch CertsURL. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// ClockSkew is the tolerance applied to "exp" and "iat". Defaults to one minute.
+	ClockSkew time.Duration
+}
+
+// IdentityTokenVerifier validates Google-signed identity tokens received by a service, such as the
+// tokens Cloud Run, Cloud Tasks and Pub/Sub push subscriptions attach to requests, or IAP assertions.
+type IdentityTokenVerifier struct {
+	config IdentityTokenConfig
+	keySet *jwk.RemoteSet
+}
+
+// NewIdentityTokenVerifier creates an IdentityTokenVerifier, applying defaults for unset fields.
+//
+// Returns:
+//   - A pointer to the IdentityTokenVerifier.
+//   - An error if no audience is configured.
+func NewIdentityTokenVerifier(config IdentityTokenConfig) (*IdentityTokenVerifier, error) {
+	if config.Audience == "" {
+		return nil, errors.New("an audience is required to verify identity tokens")
+	}
+
+	if config.CertsURL == "" {
+		config.CertsURL = GoogleCertsURL
+	}
+
+	if len(config.Issuers) == 0 {
+		config.Issuers = GoogleIssuers
+	}
+
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = []common.AlgorithmType{common.RS256}
+	}
+
+	if config.ClockSkew == 0 {
+		config.ClockSkew = time.Minute
+	}
+
+	return &IdentityTokenVerifier{
+		config: config,
+		keySet: jwk.NewRemoteSet(config.CertsURL, config.HTTPClient),
+	}, nil
+}
+
+// NewIAPTokenVerifier creates an IdentityTokenVerifier for Identity-Aware Proxy assertions.
+// The audience has the form /projects/PROJECT_NUMBER/global/backendServices/SERVICE_ID for backend
+// services, or /projects/PROJECT_NUMBER/apps/PROJECT_ID for App Engine.
+//
+// Unset fields default to IAPCertsURL, IAPIssuer and ES256; set CertsURL to verify against a local fake such
+// as gcptest.IAP.
+func NewIAPTokenVerifier(config IdentityTokenConfig) (*IdentityTokenVerifier, error) {
+	if config.CertsURL == "" {
+		config.CertsURL = IAPCertsURL
+	}
+
+	if len(config.Issuers) == 0 {
+		config.Issuers = []string{IAPIssuer}
+	}
+
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = []common.AlgorithmType{common.ES256}
+	}
+
+	return NewIdentityTokenVerifier(config)
+}
+
+// Verify validates tokenString and returns its claims.
+//
+// Parameters:
+//   - ctx: The context used if the signing keys have to be fetched.
+//   - tokenString: The compact serialized identity token.
+//
+// Returns:
+//   - The token's claims.
+//   - An error if the signature, issuer, audience, expiry or caller email is not acceptable.
+func (v *IdentityTokenVerifier) Verify(ctx context.Context, tokenString string) (common.ClaimSet, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid identity token format")
+	}
+
+	token := new(jws.Token)
+	if err := token.Decode(parts); err != nil {
+		return nil, fmt.Errorf("failed to decode identity token: %w", err)
+	}
+
+	alg, err := token.Header.GetAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+
+	if !containsAlgorithm(v.config.Algorithms, alg) {
+		return nil, fmt.Errorf("identity token signed with unsupported algorithm: %s", alg)
+	}
+
+	keyID, _ := token.Header.Data["kid"].(string)
+	keys, err := v.keySet.Keys(ctx, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find identity token signing key: %w", err)
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		publicKey, err := key.PublicKey()
+		if err == nil && jws.VerifySignature(alg, signingInput, token.Signature.Metadata.Bytes, publicKey) == nil {
+			verified = true
+			break
+		}
+	}
+
+	if !verified {
+		return nil, errors.New("identity token signature is invalid")
+	}
+
+	claims := token.Payload.Data
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// VerifyRequest validates the identity token carried by req. IAP assertions are read from the
+// IAPAssertionHeader; other tokens are read from the Authorization bearer header.
+func (v *IdentityTokenVerifier) VerifyRequest(req *http.Request) (common.ClaimSet, error) {
+	tokenString := req.Header.Get(IAPAssertionHeader)
+	if tokenString == "" || !containsString(v.config.Issuers, IAPIssuer) {
+		var err error
+		tokenString, err = helpers.GetBearerTokenFromRequestHeader(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return v.Verify(req.Context(), tokenString)
+}
+
+// TokenValidator adapts the verifier for use with helpers.BearerTokenMiddleware. Signing keys are fetched
+// with the request context.
+func (v *IdentityTokenVerifier) TokenValidator() helpers.TokenValidator {
+	return v.Verify
+}
+
+// Middleware returns a helpers.Middleware that rejects requests without a valid identity token with
+// 401 Unauthorized. The verified claims are available through helpers.ClaimsFromContext.
+func (v *IdentityTokenVerifier) Middleware() helpers.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := v.VerifyRequest(r)
+			if err != nil {
+				util.LogError("Failed to verify identity token: %v", err)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(helpers.ContextWithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+func (v *IdentityTokenVerifier) validateClaims(claims common.ClaimSet) error {
+	now := time.Now()
+
+	issuer, _ := claims.GetString(string(common.Issuer))
+	if !containsString(v.config.Issuers, issuer) {
+		return fmt.Errorf("identity token issued by unexpected issuer %q", issuer)
+	}
+
+	if !containsString(claims.Audience(), v.config.Audience) {
+		return fmt.Errorf("identity token audience does not include %q", v.config.Audience)
+	}
+
+	expiresAt, found := claims.ExpiresAt()
+	if !found {
+		return errors.New("identity token has no valid exp claim")
+	}
+
+	if !now.Before(expiresAt.Add(v.config.ClockSkew)) {
+		return errors.New("identity token has expired")
+	}
+
+	if issuedAt, found := claims.GetTime(string(common.IssuedAt)); found && issuedAt.After(now.Add(v.config.ClockSkew)) {
+		return errors.New("identity token was issued in the future")
+	}
+
+	if len(v.config.AllowedEmails) > 0 {
+		email, _ := claims.GetString(emailClaim)
+		if !containsString(v.config.AllowedEmails, email) {
+			return fmt.Errorf("identity token email %q is not allowed", email)
+		}
+
+		if issuer != IAPIssuer && claims[emailVerifiedClaim] != true {
+			return errors.New("identity token email is not verified")
+		}
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsAlgorithm(values []common.AlgorithmType, value common.AlgorithmType) bool {
+	for _, v := range values {
+		if v == value && v != common.None {
+			return true
+		}
+	}
+
+	return false
+}
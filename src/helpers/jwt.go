@@ -5,26 +5,29 @@ import (
 	"github.com/bmwadforth-com/armor-go/src/util"
 	"github.com/bmwadforth-com/armor-go/src/util/jwt"
 	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/session"
 	"net/http"
+	"sort"
 	"strings"
 )
 
 func NewHS256BearerToken(key string, claims common.ClaimSet) (string, error) {
 	privateKey := []byte(key)
-	tokenBuilder := jwt.NewJWSToken(common.HS256, privateKey)
-	token, err := tokenBuilder.AddClaims(claims).Serialize()
+	tokenBuilder := jwt.NewJWSToken(common.HS256, privateKey).AddClaims(claims)
+	token, err := tokenBuilder.Serialize()
 	if err != nil {
 		util.LogError("Failed to generate token: %v", err)
 		return "", err
 	}
 
-	claimsSerialized, err := claims.MarshalJSON()
-	if err != nil {
-		util.LogError("Failed to serialize claims: %v", err)
-		return "", err
+	// Only the claim names are logged, as claim values may be personal data.
+	names := make([]string, 0, len(tokenBuilder.GetClaims()))
+	for name := range tokenBuilder.GetClaims() {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	util.LogInfo("new token generated with claims: %s", string(claimsSerialized))
+	util.LogInfo("new token generated with claims: %s", strings.Join(names, ", "))
 
 	return token, nil
 }
@@ -38,7 +41,7 @@ func ValidateHS256BearerToken(key string, tokenString string) bool {
 		return false
 	}
 
-	_, err = tokenBuilder.Validate()
+	_, err = tokenBuilder.RequireAlgorithm(common.HS256).Validate()
 	if err != nil {
 		util.LogError("Failed to validate token: %v", err)
 		return false
@@ -69,3 +72,12 @@ func GetClaimsFromToken(key string, tokenString string) map[string]interface{} {
 
 	return tokenBuilder.GetClaims()
 }
+
+// NewHS256TokenService creates a session.Service that signs access tokens with HS256 using key
+// and keeps opaque refresh tokens in memory.
+func NewHS256TokenService(key string) (*session.Service, error) {
+	return session.NewService(session.Config{
+		SigningAlgorithm: common.HS256,
+		SigningKey:       []byte(key),
+	})
+}
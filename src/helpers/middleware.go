@@ -0,0 +1,193 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/bmwadforth-com/armor-go/src/util/audit"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/authz"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"net/http"
+)
+
+type contextKey string
+
+const claimsContextKey contextKey = "armor.claims"
+
+// RequestIDHeader is the header read and written by RequestIDMiddleware.
+const RequestIDHeader = "X-Request-Id"
+
+// Middleware wraps an http.Handler with additional behaviour.
+type Middleware func(next http.Handler) http.Handler
+
+// TokenValidator decodes and validates a token string, returning its claims when the token is valid.
+// ctx is the request context; validators use it for key fetches, revocation lookups and audit events.
+type TokenValidator func(ctx context.Context, tokenString string) (common.ClaimSet, error)
+
+// NewKeyTokenValidator returns a TokenValidator that decodes and validates tokens with the given key.
+// The key is used exactly as it would be with jwt.DecodeToken.
+//
+// Parameters:
+//   - algorithm: The algorithm tokens must be signed with, e.g. common.HS256. Tokens whose header names any
+//     other algorithm, including "none", are rejected.
+//   - key: The key used to verify the tokens.
+func NewKeyTokenValidator(algorithm common.AlgorithmType, key []byte) TokenValidator {
+	return NewRevocableTokenValidator(algorithm, key, nil)
+}
+
+// NewRevocableTokenValidator is like NewKeyTokenValidator but additionally rejects tokens whose
+// "jti" has been revoked in store. A nil store disables the revocation check.
+func NewRevocableTokenValidator(algorithm common.AlgorithmType, key []byte, store jwt.RevocationStore) TokenValidator {
+	return func(ctx context.Context, tokenString string) (common.ClaimSet, error) {
+		tokenBuilder, err := jwt.DecodeTokenContext(ctx, tokenString, key)
+		if err != nil {
+			return nil, err
+		}
+
+		tokenBuilder.RequireAlgorithm(algorithm)
+		if store != nil {
+			tokenBuilder.WithRevocationStore(store)
+		}
+
+		_, err = tokenBuilder.ValidateContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return tokenBuilder.GetClaims(), nil
+	}
+}
+
+// BearerTokenMiddleware authenticates requests using the bearer token in the Authorization header.
+//
+// Parameters:
+//   - validate: The TokenValidator used to validate the bearer token.
+//
+// Returns:
+//   - A Middleware that responds with 401 Unauthorized when the token is missing or invalid. Otherwise,
+//     the validated claims are stored on the request context and can be read with ClaimsFromContext, and
+//     the "sub" claim is added to lines logged with the request context (see util.ContextWithSubject).
+//
+// A missing token is recorded as an audit.TokenValidationFailed event; the jwt package records invalid ones.
+func BearerTokenMiddleware(validate TokenValidator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString, err := GetBearerTokenFromRequestHeader(r)
+			if err != nil {
+				audit.Emit(r.Context(), audit.Event{
+					Type:   audit.TokenValidationFailed,
+					Source: "helpers",
+					Reason: "missing or malformed bearer token",
+				})
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := validate(r.Context(), tokenString)
+			if err != nil {
+				util.LogErrorCtx(r.Context(), "Failed to validate bearer token: %v", err)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			ctx := ContextWithClaims(r.Context(), claims)
+			if subject, ok := claims.GetString(string(common.Subject)); ok {
+				ctx = util.ContextWithSubject(ctx, subject)
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIDMiddleware attaches a request ID to the request context, so that every line logged with it by
+// util.LogCtx and its variants carries the ID.
+//
+// Returns:
+//   - A Middleware that uses the X-Request-Id request header when present, otherwise generates a random ID, and
+//     echoes the ID in the X-Request-Id response header.
+func RequestIDMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(RequestIDHeader)
+			if !validRequestID(requestID) {
+				requestID = newRequestID()
+			}
+
+			w.Header().Set(RequestIDHeader, requestID)
+			next.ServeHTTP(w, r.WithContext(util.ContextWithRequestID(r.Context(), requestID)))
+		})
+	}
+}
+
+// validRequestID rejects missing, oversized or non-printable IDs supplied by clients, which would otherwise
+// be written to the logs verbatim.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > 128 {
+		return false
+	}
+
+	for _, c := range requestID {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// HS256BearerTokenMiddleware is a BearerTokenMiddleware for tokens issued by NewHS256BearerToken. Tokens signed
+// with any other algorithm are rejected.
+func HS256BearerTokenMiddleware(key string) Middleware {
+	return BearerTokenMiddleware(NewKeyTokenValidator(common.HS256, []byte(key)))
+}
+
+// ContextWithClaims returns a copy of ctx carrying the given validated claims.
+func ContextWithClaims(ctx context.Context, claims common.ClaimSet) context.Context {
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+// ClaimsFromContext returns the validated claims stored by BearerTokenMiddleware, if any.
+func ClaimsFromContext(ctx context.Context) (common.ClaimSet, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(common.ClaimSet)
+	return claims, ok
+}
+
+// RequirePolicy returns a Middleware that only admits requests whose claims satisfy the policy.
+// It must be installed behind BearerTokenMiddleware. Requests without claims are rejected with
+// 401 Unauthorized and requests that fail the policy are rejected with 403 Forbidden.
+func RequirePolicy(policy authz.Policy) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			if !policy(claims) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScopes returns a Middleware that requires the token to grant every given scope.
+func RequireScopes(scopes ...string) Middleware {
+	return RequirePolicy(authz.Scope(scopes...))
+}
+
+// RequireAnyRole returns a Middleware that requires the token to carry at least one of the given roles.
+func RequireAnyRole(roles ...string) Middleware {
+	return RequirePolicy(authz.Role(roles...))
+}
@@ -0,0 +1,228 @@
+package helpers
+
+import (
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TraceparentHeader is the W3C Trace Context header.
+	TraceparentHeader = "traceparent"
+	// CloudTraceContextHeader is the legacy Google Cloud trace header, "TRACE_ID/SPAN_ID;o=OPTIONS".
+	CloudTraceContextHeader = "X-Cloud-Trace-Context"
+)
+
+// TraceContext identifies the trace and span a request belongs to.
+type TraceContext struct {
+	// TraceID is the 32 character lowercase hex trace ID.
+	TraceID string
+	// SpanID is the 16 character lowercase hex span ID, or "" if the header did not include one.
+	SpanID  string
+	Sampled bool
+}
+
+// ParseTraceContext reads the trace context of a request from its traceparent header or, failing that, its
+// X-Cloud-Trace-Context header.
+//
+// Parameters:
+//   - header: The request headers.
+//
+// Returns:
+//   - The trace context, and whether a valid one was found.
+func ParseTraceContext(header http.Header) (TraceContext, bool) {
+	if tc, ok := parseTraceparent(header.Get(TraceparentHeader)); ok {
+		return tc, true
+	}
+
+	return parseCloudTraceContext(header.Get(CloudTraceContextHeader))
+}
+
+// parseTraceparent parses "VERSION-TRACE_ID-SPAN_ID-FLAGS", e.g. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func parseTraceparent(value string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return TraceContext{}, false
+	}
+
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isHexID(traceID, 32) || !isHexID(spanID, 16) || !isHexID(flags, 2) {
+		return TraceContext{}, false
+	}
+
+	flagBits, _ := strconv.ParseUint(flags, 16, 8)
+	return TraceContext{TraceID: traceID, SpanID: spanID, Sampled: flagBits&1 == 1}, true
+}
+
+// parseCloudTraceContext parses "TRACE_ID/SPAN_ID;o=OPTIONS", where SPAN_ID is decimal and both it and the
+// options are optional.
+func parseCloudTraceContext(value string) (TraceContext, bool) {
+	value, options, _ := strings.Cut(strings.TrimSpace(value), ";")
+	traceID, spanID, hasSpan := strings.Cut(value, "/")
+
+	traceID = strings.ToLower(traceID)
+	if !isHexID(traceID, 32) {
+		return TraceContext{}, false
+	}
+
+	tc := TraceContext{TraceID: traceID, Sampled: options == "o=1"}
+	if hasSpan && spanID != "" {
+		span, err := strconv.ParseUint(spanID, 10, 64)
+		if err != nil {
+			return TraceContext{}, false
+		}
+		if span != 0 {
+			tc.SpanID = fmt.Sprintf("%016x", span)
+		}
+	}
+
+	return tc, true
+}
+
+// isHexID reports whether id is a lowercase hex string of the given length that is not all zeros, which
+// both trace headers treat as invalid.
+func isHexID(id string, length int) bool {
+	if len(id) != length {
+		return false
+	}
+
+	nonZero := false
+	for _, c := range id {
+		switch {
+		case c == '0':
+		case c >= '1' && c <= '9', c >= 'a' && c <= 'f':
+			nonZero = true
+		default:
+			return false
+		}
+	}
+
+	return nonZero || length == 2
+}
+
+// TraceMiddleware adds the trace context of each request to the request context, so that lines logged with it
+// by util.LogCtx and its variants are grouped under the request in Cloud Logging.
+//
+// Parameters:
+//   - projectID: The Google Cloud project receiving the traces, e.g. os.Getenv("GOOGLE_CLOUD_PROJECT"). When
+//     empty, only the trace_id field is logged.
+//
+// Returns:
+//   - A Middleware that leaves requests without a valid traceparent or X-Cloud-Trace-Context header unchanged.
+func TraceMiddleware(projectID string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tc, ok := ParseTraceContext(r.Header); ok {
+				r = r.WithContext(util.ContextWithTrace(r.Context(), projectID, tc.TraceID, tc.SpanID, tc.Sampled))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestLoggingMiddleware logs every completed request with Cloud Logging's httpRequest field and the fields
+// attached to the request context. Install it behind TraceMiddleware and RequestIDMiddleware so the log line
+// carries their fields.
+//
+// Parameters:
+//   - trustedHops: The number of trailing X-Forwarded-For entries appended by infrastructure in front of the
+//     service. The logged remote IP is the left-most of them; anything before it was sent by the client and
+//     is ignored. Use 1 for Cloud Run, 2 for Cloud Run behind an external Application Load Balancer (which
+//     appends the client address and its own), and 0 to log the connection's remote address instead.
+//
+// Returns:
+//   - A Middleware that logs at error level for 5xx responses, warning level for 4xx responses and info level
+//     otherwise.
+func RequestLoggingMiddleware(trustedHops int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(recorder, r)
+
+			status := recorder.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			level := zap.InfoLevel
+			switch {
+			case status >= 500:
+				level = zap.ErrorLevel
+			case status >= 400:
+				level = zap.WarnLevel
+			}
+
+			util.LoggerFromContext(r.Context()).Log(level,
+				fmt.Sprintf("[ARMOR]: %s %s %d", r.Method, r.URL.Path, status),
+				util.HTTPRequestField(util.HTTPRequest{
+					Method:       r.Method,
+					URL:          r.URL.String(),
+					Status:       status,
+					RequestSize:  r.ContentLength,
+					ResponseSize: recorder.size,
+					UserAgent:    r.UserAgent(),
+					RemoteIP:     remoteIP(r, trustedHops),
+					Referer:      r.Referer(),
+					Protocol:     r.Proto,
+					Latency:      time.Since(start),
+				}),
+			)
+		})
+	}
+}
+
+// remoteIP returns the client address: the X-Forwarded-For entry trustedHops from the end, which was appended by
+// the outermost trusted proxy. Clients can prepend arbitrary entries, so earlier ones are never used. With fewer
+// entries than trustedHops, every entry was added by a trusted proxy and the first is used.
+func remoteIP(r *http.Request, trustedHops int) string {
+	if forwarded := r.Header.Values("X-Forwarded-For"); trustedHops > 0 && len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		index := len(hops) - trustedHops
+		if index < 0 {
+			index = 0
+		}
+		return strings.TrimSpace(hops[index])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// statusRecorder captures the status and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer, e.g. to flush.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
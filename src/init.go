@@ -3,44 +3,160 @@ package armor
 import (
 	"context"
 	"github.com/bmwadforth-com/armor-go/src/util"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"os"
 )
 
 var (
+	// ArmorContext is cancelled when Shutdown is called, or when the process receives one of Signals.
 	ArmorContext  context.Context
 	IsRelease     bool
 	InitCalled    bool
-	CleanupLogger func()
+	// CleanupLogger flushes the global logger created by InitArmor, returning an error if it cannot be flushed.
+	CleanupLogger func() error
+
+	// Default is the Armor instance created by InitArmor or InitArmorLayered, which share their logger and
+	// context with the globals above. Prefer New when more than one instance is needed.
+	Default *Armor
+
+	// SecretSource, when set before calling InitArmor, is used to resolve configuration fields tagged
+	// with `secret:"<secret name>"` (see util.LoadSecrets), e.g. a Secret Manager source from the gcp helpers.
+	SecretSource util.SecretSource
+
+	// LogOptions, when set before calling InitArmor, adds sinks and sampling to the global logger (see
+	// util.LoggerOptions). The release mode and minimum level are taken from InitArmor's arguments.
+	LogOptions *util.LoggerOptions
+
+	// BaseLogger, when set before calling InitArmor, is used as the global logger instead of creating one, and
+	// LogOptions and the minimum level are ignored.
+	BaseLogger *zap.Logger
+
+	// Signals, when set before calling InitArmor, cancels ArmorContext on the first of these signals instead of
+	// letting it terminate the process, e.g. []os.Signal{os.Interrupt, syscall.SIGTERM}. Only set it if the
+	// application calls Wait or watches ArmorContext; otherwise the signal is swallowed. See WithSignals.
+	Signals []os.Signal
 )
 
-// InitArmor initializes the application's configuration and logging based on the release mode.
+// InitArmor initializes the application's configuration and logging based on the release mode. It is a wrapper
+// around New that also sets the package globals and the global logger used by the util.Log functions.
 //
 // Parameters:
 //   - isRelease: Indicates whether the application is running in release mode (true) or not (false).
 //   - minLevel: The minimum logging level to be used (e.g., zapcore.InfoLevel).
 //   - config: A pointer to the configuration struct to be populated.
-//   - configPath: The path to the configuration file (used in non-release mode). e.g. config.local.json
+//   - configPath: The path to the configuration file (used in non-release mode). e.g. config.local.json or
+//     config.local.yaml; see util.LoadConfiguration for the supported formats.
+//
+// If SecretSource is set, secrets are loaded before the environment variables or configuration file. Values in
+// the configuration file override secrets; environment variables only do so for fields tagged `env:",overwrite"`.
+//
+// The loaded configuration is logged at info level with secrets masked (see util.RedactConfiguration). Signals are
+// left to their default behaviour unless Signals is set, in which case ArmorContext is cancelled on them instead;
+// call Wait, or Shutdown, to run the hooks registered with OnShutdown and flush the logger before exiting.
 //
 // Returns:
 //   - An error if there's an issue loading configuration or environment variables.
 func InitArmor[T util.Configuration](isRelease bool, minLevel zapcore.Level, config *T, configPath string) error {
+	initGlobals(isRelease, minLevel)
+
+	a, err := New(
+		WithRelease(isRelease),
+		WithLogger(util.Logger),
+		WithSignals(Signals...),
+		WithSecretSource(SecretSource),
+		WithConfiguration(*config, configPath),
+	)
+	if err != nil {
+		util.LogFatal("Error loading configuration: %v", err)
+		return err
+	}
+	Default = a
+	ArmorContext = a.Context()
+
+	return nil
+}
+
+// InitArmorLayered initializes logging and loads the configuration from defaults, a file, environment variables
+// and command-line flags, in that order of precedence (see util.LoadLayeredConfiguration). Unlike InitArmor, the
+// file and environment variables are both applied regardless of the release mode.
+//
+// Parameters:
+//   - isRelease: Indicates whether the application is running in release mode (true) or not (false).
+//   - minLevel: The minimum logging level to be used (e.g., zapcore.InfoLevel).
+//   - config: A pointer to the configuration struct to be populated.
+//   - options: The layers to load, e.g. util.LayeredOptions{Files: []string{"config.yaml", "config.staging.yaml"}, Args: os.Args[1:]}.
+//
+// If options.Secrets is nil, SecretSource is used for the secret layer.
+//
+// Returns:
+//   - A report of which layer provided each configuration field, which is also logged at debug level.
+//   - An error if there's an issue loading or validating the configuration.
+func InitArmorLayered[T util.Configuration](isRelease bool, minLevel zapcore.Level, config *T, options util.LayeredOptions) (util.ConfigReport, error) {
+	initGlobals(isRelease, minLevel)
+
+	a, err := New(
+		WithRelease(isRelease),
+		WithLogger(util.Logger),
+		WithSignals(Signals...),
+		WithSecretSource(SecretSource),
+		WithLayeredConfiguration(*config, options),
+	)
+	if err != nil {
+		util.LogFatal("Error loading configuration: %v", err)
+		return nil, err
+	}
+	Default = a
+	ArmorContext = a.Context()
+
+	return a.ConfigReport(), nil
+}
+
+// initGlobals sets the package globals and initializes the global logger used by the util.Log functions.
+func initGlobals(isRelease bool, minLevel zapcore.Level) {
 	ArmorContext = context.Background()
 	IsRelease = isRelease
 	InitCalled = true
 
-	CleanupLogger = util.InitLogger(isRelease, minLevel)
-
-	if IsRelease {
-		if err := util.LoadEnvironmentVariables(*config); err != nil {
-			util.LogFatal("Error loading environment variables: %v", err)
-			return err
-		}
-	} else {
-		if err := util.LoadConfiguration(configPath, *config); err != nil {
-			util.LogFatal("Error loading configuration file: %v", err)
-			return err
+	if BaseLogger != nil {
+		util.SetLogger(BaseLogger)
+		CleanupLogger = func() error {
+			return util.SyncLogger(BaseLogger)
 		}
+		return
 	}
 
-	return nil
+	if LogOptions != nil {
+		options := *LogOptions
+		options.IsRelease = isRelease
+		options.MinimumLevel = minLevel
+		options.Level = zap.AtomicLevel{}
+		CleanupLogger = util.InitLoggerWithOptions(options)
+		return
+	}
+
+	CleanupLogger = util.InitLogger(isRelease, minLevel)
+}
+
+// OnShutdown registers a hook on the instance created by InitArmor (see Armor.OnShutdown).
+func OnShutdown(name string, hook ShutdownHook) {
+	mustDefault().OnShutdown(name, hook)
+}
+
+// Wait blocks until ArmorContext is cancelled, e.g. by one of Signals, and then shuts down the instance created by
+// InitArmor (see Armor.Wait).
+func Wait() error {
+	return mustDefault().Wait()
+}
+
+// Shutdown shuts down the instance created by InitArmor (see Armor.Shutdown).
+func Shutdown(ctx context.Context) error {
+	return mustDefault().Shutdown(ctx)
+}
+
+func mustDefault() *Armor {
+	if Default == nil {
+		panic("[ARMOR] Before calling this function you must call InitArmor")
+	}
+	return Default
 }
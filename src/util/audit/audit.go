@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"go.uber.org/zap/zapcore"
+	"sync/atomic"
+	"time"
+)
+
+// EventType identifies a security-relevant action.
+type EventType string
+
+const (
+	// TokenIssued is emitted when a token is signed or encrypted.
+	TokenIssued EventType = "token.issued"
+	// TokenValidated is emitted when a token passes validation.
+	TokenValidated EventType = "token.validated"
+	// TokenValidationFailed is emitted when a token cannot be decoded or fails validation. Reason holds the error.
+	TokenValidationFailed EventType = "token.validation_failed"
+	// KeyRotated is emitted when the keys published in a key set change.
+	KeyRotated EventType = "key.rotated"
+	// PasswordVerificationFailed is emitted when a password does not match its hash.
+	PasswordVerificationFailed EventType = "password.verification_failed"
+)
+
+// Event is a structured audit record. Events never carry token or password material.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Source is the component that emitted the event, e.g. "jwt".
+	Source string `json:"source,omitempty"`
+	// Subject is the "sub" claim of the token involved, when known and trusted.
+	Subject string `json:"subject,omitempty"`
+	// TokenID is a hash of the "jti" claim of the token involved (see HashTokenID), when known and trusted. The
+	// claim itself is never recorded, as it can be used to revoke the token.
+	TokenID   string   `json:"token_id,omitempty"`
+	Algorithm string   `json:"algorithm,omitempty"`
+	KeyIDs    []string `json:"key_ids,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+	// RequestID and TraceID are copied from the context the event is emitted with (see util.ContextWithRequestID).
+	RequestID string `json:"request_id,omitempty"`
+	TraceID   string `json:"trace_id,omitempty"`
+}
+
+func (e Event) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("type", string(e.Type))
+	enc.AddTime("time", e.Time)
+	addNonEmpty(enc, "source", e.Source)
+	addNonEmpty(enc, "subject", e.Subject)
+	addNonEmpty(enc, "token_id", e.TokenID)
+	addNonEmpty(enc, "algorithm", e.Algorithm)
+	if len(e.KeyIDs) > 0 {
+		_ = enc.AddArray("key_ids", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			for _, keyID := range e.KeyIDs {
+				arr.AppendString(keyID)
+			}
+			return nil
+		}))
+	}
+	addNonEmpty(enc, "reason", e.Reason)
+	addNonEmpty(enc, "request_id", e.RequestID)
+	addNonEmpty(enc, "trace_id", e.TraceID)
+	return nil
+}
+
+func addNonEmpty(enc zapcore.ObjectEncoder, key string, value string) {
+	if value != "" {
+		enc.AddString(key, value)
+	}
+}
+
+// HashTokenID returns the value recorded as an event's TokenID for a token whose "jti" claim is jti, e.g. to
+// find the events for a token in the audit log.
+func HashTokenID(jti string) string {
+	sum := sha256.Sum256([]byte(jti))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Sink records audit events. Implementations must be safe for concurrent use.
+type Sink interface {
+	Write(ctx context.Context, event Event) error
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(ctx context.Context, event Event) error
+
+func (f SinkFunc) Write(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+type sinkHolder struct {
+	sink Sink
+}
+
+var currentSink atomic.Pointer[sinkHolder]
+
+func init() {
+	SetSink(NewLoggerSink())
+}
+
+// SetSink replaces the sink receiving every emitted event. Defaults to NewLoggerSink. A nil sink discards events.
+func SetSink(sink Sink) {
+	currentSink.Store(&sinkHolder{sink: sink})
+}
+
+// CurrentSink returns the sink set with SetSink.
+func CurrentSink() Sink {
+	return currentSink.Load().sink
+}
+
+// Emit records event with the current sink. The time, request ID and trace ID are filled in when unset.
+// Failures to write the event are logged rather than returned, so that auditing never blocks authentication.
+//
+// Parameters:
+//   - ctx: The context of the action being audited, typically a request context.
+//   - event: The event to record.
+func Emit(ctx context.Context, event Event) {
+	sink := CurrentSink()
+	if sink == nil {
+		return
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.RequestID == "" {
+		event.RequestID, _ = util.RequestIDFromContext(ctx)
+	}
+	if event.TraceID == "" {
+		event.TraceID, _ = util.TraceIDFromContext(ctx)
+	}
+
+	if err := sink.Write(ctx, event); err != nil {
+		util.LogErrorCtx(ctx, "Failed to write audit event %s: %v", event.Type, err)
+	}
+}
@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// NewLoggerSink returns a Sink that writes each event at info level to the global logger, under the "audit" key,
+// together with the fields attached to the event's context.
+func NewLoggerSink() Sink {
+	return SinkFunc(func(ctx context.Context, event Event) error {
+		util.LoggerFromContext(ctx).Info(fmt.Sprintf("[ARMOR]: Audit %s", event.Type), zap.Object("audit", event))
+		return nil
+	})
+}
+
+// FileSink appends events to a file as JSON lines. The file is only ever appended to, and each event is synced
+// to disk before Write returns.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens, or creates, the file at path for appending events.
+//
+// Returns:
+//   - The FileSink. Call Close when it is no longer needed.
+//   - An error if the file cannot be opened.
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return &FileSink{file: file}, nil
+}
+
+func (s *FileSink) Write(_ context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("audit log is closed")
+	}
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+
+	return s.file.Sync()
+}
+
+// Close closes the file. Later writes fail.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// NewChannelSink returns a Sink that sends each event on ch, e.g. to forward events to a SIEM from another
+// goroutine. Writes block until the event is received or the event's context is done.
+func NewChannelSink(ch chan<- Event) Sink {
+	return SinkFunc(func(ctx context.Context, event Event) error {
+		select {
+		case ch <- event:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// NewMultiSink returns a Sink that writes each event to every sink, e.g. both the logger and a file.
+//
+// Returns:
+//   - A Sink whose Write returns an error joining the failure of every sink.
+func NewMultiSink(sinks ...Sink) Sink {
+	return SinkFunc(func(ctx context.Context, event Event) error {
+		var errs []error
+		for _, sink := range sinks {
+			if err := sink.Write(ctx, event); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
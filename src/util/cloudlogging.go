@@ -0,0 +1,171 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"strconv"
+	"time"
+)
+
+// Keys of the special fields recognised by Cloud Logging in structured logs written to stdout by Cloud Run.
+const (
+	CloudTraceKey          = "logging.googleapis.com/trace"
+	CloudSpanIDKey         = "logging.googleapis.com/spanId"
+	CloudTraceSampledKey   = "logging.googleapis.com/trace_sampled"
+	CloudSourceLocationKey = "logging.googleapis.com/sourceLocation"
+	CloudHTTPRequestKey    = "httpRequest"
+)
+
+// CloudLoggingEncoderConfig returns the JSON encoder configuration used by the release logger, which maps zap
+// levels to Cloud Logging severities.
+func CloudLoggingEncoderConfig() zapcore.EncoderConfig {
+	var encoderConfig = zapcore.EncoderConfig{
+		TimeKey:        "time",
+		LevelKey:       "severity",
+		NameKey:        "logger",
+		MessageKey:     "message",
+		StacktraceKey:  "stacktrace",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.MillisDurationEncoder,
+	}
+
+	// Map Zap levels to Cloud Run severity levels
+	encoderConfig.EncodeLevel = func(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+		switch l {
+		case zapcore.DebugLevel:
+			enc.AppendString("DEBUG")
+		case zapcore.InfoLevel:
+			enc.AppendString("INFO")
+		case zapcore.WarnLevel:
+			enc.AppendString("WARNING")
+		case zapcore.ErrorLevel, zapcore.DPanicLevel, zapcore.PanicLevel, zapcore.FatalLevel:
+			enc.AppendString("ERROR")
+		default:
+			enc.AppendString("UNKNOWN")
+		}
+	}
+
+	return encoderConfig
+}
+
+// NewCloudLoggingCore creates a core that writes JSON understood by Cloud Logging. The caller of each entry is
+// written as logging.googleapis.com/sourceLocation, so loggers using the core should be created with zap.AddCaller.
+//
+// Parameters:
+//   - w: Where to write the entries, os.Stdout on Cloud Run.
+//   - level: The minimum level to write.
+//
+// Returns:
+//   - The new core.
+func NewCloudLoggingCore(w zapcore.WriteSyncer, level zapcore.LevelEnabler) zapcore.Core {
+	return sourceLocationCore{zapcore.NewCore(zapcore.NewJSONEncoder(CloudLoggingEncoderConfig()), w, level)}
+}
+
+// ContextWithTrace returns a copy of ctx whose log lines are grouped under the trace in Cloud Logging.
+//
+// Parameters:
+//   - ctx: The context to extend, typically a request context.
+//   - projectID: The Google Cloud project the trace belongs to. When empty, only the trace_id field is attached,
+//     as Cloud Logging requires the trace's full resource name.
+//   - traceID: The 32 character hex trace ID.
+//   - spanID: The 16 character hex span ID, or "" if unknown.
+//   - sampled: Whether the trace is sampled.
+//
+// Returns:
+//   - The new context.
+func ContextWithTrace(ctx context.Context, projectID string, traceID string, spanID string, sampled bool) context.Context {
+	fields := []zap.Field{zap.String(LogFieldTraceID, traceID)}
+	if projectID != "" {
+		fields = append(fields,
+			zap.String(CloudTraceKey, fmt.Sprintf("projects/%s/traces/%s", projectID, traceID)),
+			zap.Bool(CloudTraceSampledKey, sampled),
+		)
+		if spanID != "" {
+			fields = append(fields, zap.String(CloudSpanIDKey, spanID))
+		}
+	}
+
+	return ContextWithLogFields(ctx, fields...)
+}
+
+// HTTPRequest describes a completed request in the format Cloud Logging displays in the request log.
+type HTTPRequest struct {
+	Method       string
+	URL          string
+	Status       int
+	RequestSize  int64
+	ResponseSize int64
+	UserAgent    string
+	RemoteIP     string
+	Referer      string
+	Protocol     string
+	Latency      time.Duration
+}
+
+// HTTPRequestField returns a field that logs the request as Cloud Logging's httpRequest.
+func HTTPRequestField(request HTTPRequest) zap.Field {
+	return zap.Object(CloudHTTPRequestKey, request)
+}
+
+func (r HTTPRequest) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("requestMethod", r.Method)
+	enc.AddString("requestUrl", r.URL)
+	if r.Status != 0 {
+		enc.AddInt("status", r.Status)
+	}
+	// Cloud Logging encodes 64-bit integers as strings.
+	if r.RequestSize > 0 {
+		enc.AddString("requestSize", strconv.FormatInt(r.RequestSize, 10))
+	}
+	enc.AddString("responseSize", strconv.FormatInt(r.ResponseSize, 10))
+	if r.UserAgent != "" {
+		enc.AddString("userAgent", r.UserAgent)
+	}
+	if r.RemoteIP != "" {
+		enc.AddString("remoteIp", r.RemoteIP)
+	}
+	if r.Referer != "" {
+		enc.AddString("referer", r.Referer)
+	}
+	if r.Protocol != "" {
+		enc.AddString("protocol", r.Protocol)
+	}
+	enc.AddString("latency", fmt.Sprintf("%.9fs", r.Latency.Seconds()))
+
+	return nil
+}
+
+// sourceLocationCore adds the caller of each entry as logging.googleapis.com/sourceLocation.
+type sourceLocationCore struct {
+	zapcore.Core
+}
+
+func (c sourceLocationCore) With(fields []zapcore.Field) zapcore.Core {
+	return sourceLocationCore{c.Core.With(fields)}
+}
+
+func (c sourceLocationCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c sourceLocationCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Caller.Defined {
+		fields = append(fields[:len(fields):len(fields)], zap.Object(CloudSourceLocationKey, sourceLocation(ent.Caller)))
+	}
+	return c.Core.Write(ent, fields)
+}
+
+type sourceLocation zapcore.EntryCaller
+
+func (l sourceLocation) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("file", l.File)
+	enc.AddString("line", strconv.Itoa(l.Line))
+	enc.AddString("function", l.Function)
+	return nil
+}
@@ -2,10 +2,8 @@ package util
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/sethvargo/go-envconfig"
-	"os"
 )
 
 // Configuration represents a type that can be loaded with configuration data
@@ -14,40 +12,42 @@ type Configuration interface {
 	Validate() error
 }
 
-// LoadConfiguration loads and unmarshals configuration from a JSON file.
-// It also performs validation on the configuration if the `Validate()` method is implemented.
+// LoadConfiguration loads and unmarshals configuration from a JSON, YAML, TOML or dotenv file.
+// The configuration is checked against its `validate` tags (see ValidateStruct) and then its `Validate()` method.
 //
 // Parameters:
-//   - configFilePath: The path to the JSON configuration file.
+//   - configFilePath: The path to the configuration file. The format is selected by DetectConfigFormat.
 //   - config: A pointer to the configuration struct to be populated.
 //
 // Returns:
-//   - An error if there's an issue reading the file, unmarshaling the JSON, or validating the configuration.
+//   - An error if there's an issue reading the file, unmarshaling it, or validating the configuration.
 func LoadConfiguration[T Configuration](configFilePath string, config T) error {
-	bytes, err := os.ReadFile(configFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
-	}
-
-	err = json.Unmarshal(bytes, &config)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal config: %w", err)
-	}
+	return LoadConfigurationFiles(config, configFilePath)
+}
 
-	// Check if the configuration type implements the Validate() method
-	if v, ok := any(config).(interface{ Validate() error }); ok {
-		// If it does, call the Validate() method for configuration validation
-		if err := v.Validate(); err != nil {
-			return fmt.Errorf("config validation failed: %w", err)
+// LoadConfigurationFiles loads several configuration files into config, in order, so that values in later
+// files override those in earlier ones (e.g. config.json followed by config.local.json). Files may use
+// different formats. Validation (see ValidateStruct) is performed once, after every file has been loaded.
+//
+// Parameters:
+//   - config: A pointer to the configuration struct to be populated.
+//   - configFilePaths: The paths to the configuration files, lowest precedence first.
+//
+// Returns:
+//   - An error if there's an issue reading or unmarshaling any file, or validating the configuration.
+func LoadConfigurationFiles[T Configuration](config T, configFilePaths ...string) error {
+	for _, configFilePath := range configFilePaths {
+		if err := decodeConfigFile(configFilePath, config); err != nil {
+			return fmt.Errorf("%s: %w", configFilePath, err)
 		}
 	}
 
-	return nil
+	return validateConfiguration(config)
 }
 
 // LoadEnvironmentVariables loads configuration values from environment variables into the provided configuration struct.
 // It utilizes the `envconfig` package to process the environment variables and populate the configuration struct accordingly.
-// Additionally, if the configuration struct implements the `Validate` method, it performs validation on the loaded configuration.
+// Additionally, the loaded configuration is checked against its `validate` tags (see ValidateStruct) and its `Validate` method.
 //
 // Parameters:
 //   - config: A pointer to the configuration struct to be populated with values from environment variables.
@@ -61,11 +61,5 @@ func LoadEnvironmentVariables[T Configuration](config T) error {
 		return fmt.Errorf("failed to process environment variables: %w", err)
 	}
 
-	if v, ok := any(config).(interface{ Validate() error }); ok {
-		if err := v.Validate(); err != nil {
-			return fmt.Errorf("config validation failed: %w", err)
-		}
-	}
-
-	return nil
+	return validateConfiguration(config)
 }
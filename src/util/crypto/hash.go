@@ -1,9 +1,12 @@
 package crypto
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"errors"
+	"github.com/bmwadforth-com/armor-go/src/util/audit"
+	"github.com/bmwadforth-com/armor-go/src/util/telemetry"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -46,7 +49,15 @@ func GenerateSha1Hash(data []byte) (string, error) {
 // If an error occurs during the hashing process, it returns a nil slice and the corresponding error.
 // Otherwise, it returns the hashed password and a nil error.
 func HashPassword(password []byte) ([]byte, error) {
+	return HashPasswordContext(context.Background(), password)
+}
+
+// HashPasswordContext hashes the password like HashPassword, recording a span and metrics for the hashing as a
+// child of any span in ctx (see the telemetry package).
+func HashPasswordContext(ctx context.Context, password []byte) ([]byte, error) {
+	_, span := telemetry.Start(ctx, telemetry.PasswordHash, bcryptAlgorithm)
 	hashedPassword, err := bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
+	span.End(err, "")
 	if err != nil {
 		return nil, err
 	}
@@ -67,11 +78,32 @@ func HashPassword(password []byte) ([]byte, error) {
 // This function uses the `bcrypt.CompareHashAndPassword` function to securely compare the provided plaintext password
 // against the given bcrypt hash. It handles potential errors that might occur during the comparison.
 // If the password matches the hash, it returns 'true' and a nil error.
-// If the password doesn't match or there's any other error, it returns 'false' along with the corresponding error.
+// If the password doesn't match or there's any other error, it returns 'false' along with the corresponding error,
+// and records an audit.PasswordVerificationFailed event.
 func PasswordHashMatch(hashedPassword []byte, password []byte) (bool, error) {
+	return PasswordHashMatchContext(context.Background(), hashedPassword, password)
+}
+
+// PasswordHashMatchContext verifies the password like PasswordHashMatch, recording a span and metrics for the
+// comparison (see the telemetry package) and emitting any audit event with ctx's request and trace IDs.
+func PasswordHashMatchContext(ctx context.Context, hashedPassword []byte, password []byte) (bool, error) {
+	ctx, span := telemetry.Start(ctx, telemetry.PasswordCompare, bcryptAlgorithm)
 	err := bcrypt.CompareHashAndPassword(hashedPassword, password)
 
+	// Errors other than a mismatch mean the hash itself could not be used.
+	reason := telemetry.ReasonMalformed
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		reason = telemetry.ReasonMismatch
+	}
+	span.End(err, reason)
+
 	if err != nil {
+		audit.Emit(ctx, audit.Event{
+			Type:   audit.PasswordVerificationFailed,
+			Source: "crypto",
+			Reason: err.Error(),
+		})
+
 		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
 			return false, err
 		} else {
@@ -81,3 +113,6 @@ func PasswordHashMatch(hashedPassword []byte, password []byte) (bool, error) {
 
 	return true, nil
 }
+
+// bcryptAlgorithm is the algorithm recorded in telemetry for password hashing.
+const bcryptAlgorithm = "bcrypt"
@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// DecodePrivateKey decodes a PEM-encoded RSA or ECDSA private key into a crypto.Signer.
+//
+// Parameters:
+//   - privateKeyPEM: A byte slice containing a PKCS#1 ("RSA PRIVATE KEY"), SEC 1 ("EC PRIVATE KEY")
+//     or PKCS#8 ("PRIVATE KEY") encoded private key.
+//
+// Returns:
+//   - The private key as a crypto.Signer. RSA keys also implement crypto.Decrypter.
+//   - An error if the PEM block is missing or the key cannot be parsed.
+func DecodePrivateKey(privateKeyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errors.New("failed to parse PEM block containing the private key")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unsupported private key type: %T", key)
+}
+
+// ConvertECDSASignature converts an ASN.1 DER encoded ECDSA signature, as returned by crypto.Signer
+// implementations (including Cloud KMS), into the fixed-width R || S form used by JWS.
+//
+// Parameters:
+//   - der: The DER encoded signature.
+//   - size: The byte length of each of R and S, e.g. 32 for P-256.
+func ConvertECDSASignature(der []byte, size int) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ECDSA signature: %w", err)
+	}
+
+	if len(rest) > 0 || sig.R.Sign() <= 0 || sig.S.Sign() <= 0 || sig.R.BitLen() > size*8 || sig.S.BitLen() > size*8 {
+		return nil, errors.New("invalid ECDSA signature")
+	}
+
+	out := make([]byte, 2*size)
+	sig.R.FillBytes(out[:size])
+	sig.S.FillBytes(out[size:])
+
+	return out, nil
+}
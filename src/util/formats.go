@@ -0,0 +1,148 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/sethvargo/go-envconfig"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ConfigFormat is the encoding of a configuration file.
+type ConfigFormat string
+
+const (
+	FormatJSON   ConfigFormat = "json"
+	FormatYAML   ConfigFormat = "yaml"
+	FormatTOML   ConfigFormat = "toml"
+	FormatDotenv ConfigFormat = "dotenv"
+)
+
+// DetectConfigFormat selects the format of a configuration file from its name: ".yaml" and ".yml" are YAML,
+// ".toml" is TOML, and ".env" (or a name starting with ".env.", such as ".env.local") is dotenv.
+// Any other name is treated as JSON.
+func DetectConfigFormat(path string) ConfigFormat {
+	base := strings.ToLower(filepath.Base(path))
+	if base == ".env" || strings.HasPrefix(base, ".env.") {
+		return FormatDotenv
+	}
+
+	switch filepath.Ext(base) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	case ".env":
+		return FormatDotenv
+	}
+
+	return FormatJSON
+}
+
+// decodeConfigFile reads the configuration file at path into config, which must be a pointer.
+//
+// YAML and TOML documents are converted to JSON before being decoded, so that every format uses the
+// struct's `json` tags and later files merge into earlier ones exactly as JSON files do. Dotenv files
+// are applied through the struct's `env` tags and override existing values.
+func decodeConfigFile(path string, config interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	format := DetectConfigFormat(path)
+	switch format {
+	case FormatYAML:
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to unmarshal config: %w", err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return fmt.Errorf("failed to unmarshal config: %w", err)
+		}
+	case FormatTOML:
+		var doc map[string]interface{}
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to unmarshal config: %w", err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return fmt.Errorf("failed to unmarshal config: %w", err)
+		}
+	case FormatDotenv:
+		vars, err := parseDotenv(data)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal config: %w", err)
+		}
+
+		err = envconfig.ProcessWith(context.Background(), &envconfig.Config{
+			Target:           config,
+			Lookuper:         envconfig.MapLookuper(vars),
+			DefaultOverwrite: true,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal config: %w", err)
+		}
+
+		return nil
+	}
+
+	// A YAML document that is empty or only comments decodes to null, which leaves config unchanged.
+	if err := json.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	return nil
+}
+
+// parseDotenv parses KEY=VALUE lines. Blank lines and lines starting with "#" are ignored, and an optional
+// "export " prefix is allowed. Values may be single quoted (literal) or double quoted (supporting escapes
+// such as \n); unquoted values end at " #".
+func parseDotenv(data []byte) (map[string]string, error) {
+	vars := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNumber)
+		}
+
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			value = unquoted
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+
+		vars[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return vars, nil
+}
@@ -0,0 +1,68 @@
+package authz
+
+import (
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+)
+
+// HasScopes reports whether the claim set grants every one of the given scopes.
+//
+// Parameters:
+//   - claims: The validated claim set of the token.
+//   - scopes: The scopes that must all be present in the space-delimited "scope" claim.
+//
+// Returns:
+//   - true if every scope is present (or no scopes were requested), false otherwise.
+func HasScopes(claims common.ClaimSet, scopes ...string) bool {
+	return containsAll(claims.Scopes(), scopes)
+}
+
+// HasAnyScope reports whether the claim set grants at least one of the given scopes.
+func HasAnyScope(claims common.ClaimSet, scopes ...string) bool {
+	return containsAny(claims.Scopes(), scopes)
+}
+
+// HasAnyRole reports whether the "roles" claim contains at least one of the given roles.
+func HasAnyRole(claims common.ClaimSet, roles ...string) bool {
+	return containsAny(claims.Roles(), roles)
+}
+
+// HasAllRoles reports whether the "roles" claim contains every one of the given roles.
+func HasAllRoles(claims common.ClaimSet, roles ...string) bool {
+	return containsAll(claims.Roles(), roles)
+}
+
+// HasAnyGroup reports whether the "groups" claim contains at least one of the given groups.
+func HasAnyGroup(claims common.ClaimSet, groups ...string) bool {
+	return containsAny(claims.Groups(), groups)
+}
+
+func containsAll(granted []string, required []string) bool {
+	set := toSet(granted)
+	for _, r := range required {
+		if !set[r] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsAny(granted []string, required []string) bool {
+	set := toSet(granted)
+	for _, r := range required {
+		if set[r] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+
+	return set
+}
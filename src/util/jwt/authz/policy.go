@@ -0,0 +1,277 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"strings"
+	"unicode"
+)
+
+// Policy decides whether a validated claim set is authorized.
+type Policy func(claims common.ClaimSet) bool
+
+// Scope returns a Policy that requires every given scope.
+func Scope(scopes ...string) Policy {
+	return func(claims common.ClaimSet) bool {
+		return HasScopes(claims, scopes...)
+	}
+}
+
+// Role returns a Policy that requires at least one of the given roles.
+func Role(roles ...string) Policy {
+	return func(claims common.ClaimSet) bool {
+		return HasAnyRole(claims, roles...)
+	}
+}
+
+// Group returns a Policy that requires at least one of the given groups.
+func Group(groups ...string) Policy {
+	return func(claims common.ClaimSet) bool {
+		return HasAnyGroup(claims, groups...)
+	}
+}
+
+// Claim returns a Policy that requires the string (or array) claim named key to contain value.
+func Claim(key string, value string) Policy {
+	return func(claims common.ClaimSet) bool {
+		return containsAny(claims.GetStrings(key), []string{value})
+	}
+}
+
+// All returns a Policy that is satisfied only when every given policy is satisfied.
+func All(policies ...Policy) Policy {
+	return func(claims common.ClaimSet) bool {
+		for _, p := range policies {
+			if !p(claims) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Any returns a Policy that is satisfied when at least one given policy is satisfied.
+func Any(policies ...Policy) Policy {
+	return func(claims common.ClaimSet) bool {
+		for _, p := range policies {
+			if p(claims) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not returns a Policy that inverts the given policy.
+func Not(policy Policy) Policy {
+	return func(claims common.ClaimSet) bool {
+		return !policy(claims)
+	}
+}
+
+// ParsePolicy compiles a policy expression into a Policy.
+//
+// Parameters:
+//   - expression: The policy expression to compile, e.g. "scope:orders.read and (role:admin or group:ops)".
+//
+// Returns:
+//   - The compiled Policy.
+//   - An error if the expression is empty or malformed.
+//
+// An expression is made of terms combined with "and", "or" and "not" (or "&&", "||" and "!"),
+// grouped with parentheses. "not" binds tightest, followed by "and", then "or". Supported terms are:
+//   - scope:<name>        the "scope" claim contains <name>
+//   - role:<name>         the "roles" claim contains <name>
+//   - group:<name>        the "groups" claim contains <name>
+//   - claim:<key>=<value> the claim <key> is, or contains, <value>
+func ParsePolicy(expression string) (Policy, error) {
+	tokens := tokenize(expression)
+	if len(tokens) == 0 {
+		return nil, errors.New("policy expression is empty")
+	}
+
+	p := &parser{tokens: tokens}
+	policy, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token %q in policy expression", p.tokens[p.pos])
+	}
+
+	return policy, nil
+}
+
+// MustParsePolicy is like ParsePolicy but panics if the expression cannot be compiled.
+// It is intended for policies declared at package initialisation.
+func MustParsePolicy(expression string) Policy {
+	policy, err := ParsePolicy(expression)
+	if err != nil {
+		panic(err)
+	}
+
+	return policy
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *parser) parseOr() (Policy, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	policies := []Policy{left}
+	for isOperator(p.peek(), "or", "||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, right)
+	}
+
+	if len(policies) == 1 {
+		return left, nil
+	}
+
+	return Any(policies...), nil
+}
+
+func (p *parser) parseAnd() (Policy, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	policies := []Policy{left}
+	for isOperator(p.peek(), "and", "&&") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, right)
+	}
+
+	if len(policies) == 1 {
+		return left, nil
+	}
+
+	return All(policies...), nil
+}
+
+func (p *parser) parseUnary() (Policy, error) {
+	if isOperator(p.peek(), "not", "!") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(operand), nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Policy, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, errors.New("unexpected end of policy expression")
+	case token == "(":
+		policy, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing closing parenthesis in policy expression")
+		}
+		return policy, nil
+	case token == ")" || isOperator(token, "and", "&&", "or", "||"):
+		return nil, fmt.Errorf("unexpected token %q in policy expression", token)
+	}
+
+	return parseTerm(token)
+}
+
+func parseTerm(token string) (Policy, error) {
+	kind, value, found := strings.Cut(token, ":")
+	if !found || value == "" {
+		return nil, fmt.Errorf("invalid policy term %q: expected <kind>:<value>", token)
+	}
+
+	switch strings.ToLower(kind) {
+	case "scope":
+		return Scope(value), nil
+	case "role":
+		return Role(value), nil
+	case "group":
+		return Group(value), nil
+	case "claim":
+		key, expected, found := strings.Cut(value, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid claim term %q: expected claim:<key>=<value>", token)
+		}
+		return Claim(key, expected), nil
+	}
+
+	return nil, fmt.Errorf("unknown policy term kind %q", kind)
+}
+
+func isOperator(token string, operators ...string) bool {
+	for _, op := range operators {
+		if strings.EqualFold(token, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenize splits a policy expression into terms, operators and parentheses.
+func tokenize(expression string) []string {
+	var tokens []string
+	var current strings.Builder
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range expression {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case r == '!' && current.Len() == 0:
+			tokens = append(tokens, "!")
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
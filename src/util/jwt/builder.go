@@ -1,14 +1,30 @@
 package jwt
 
 import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/util/audit"
 	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
 	"github.com/bmwadforth-com/armor-go/src/util/jwt/jwe"
 	"github.com/bmwadforth-com/armor-go/src/util/jwt/jws"
+	"github.com/bmwadforth-com/armor-go/src/util/telemetry"
 )
 
+// ErrUnexpectedAlgorithm is returned by Validate when the token's header names an algorithm other than the one
+// required with RequireAlgorithm or RequireAlgorithmSuite.
+var ErrUnexpectedAlgorithm = errors.New("token algorithm is not the expected algorithm")
+
 type TokenBuilder struct {
-	token    *common.Token
-	algSuite common.AlgorithmSuite
+	token             *common.Token
+	algSuite          common.AlgorithmSuite
+	requiredAlgorithm *common.AlgorithmSuite
+	revocationStore   RevocationStore
+	replayCache       ReplayCache
+	omitAuditTokenID  bool
+	// err is an error from building the token, returned by Serialize.
+	err error
 }
 
 // DecodeToken decodes a token string using the provided key and returns a TokenBuilder.
@@ -33,7 +49,35 @@ type TokenBuilder struct {
 //   - Sets the TokenBuilder's `algSuite` with the extracted algorithm.
 //     4. Returns the TokenBuilder and a nil error if successful, or a nil TokenBuilder and the
 //     corresponding error if there was an issue during decoding or algorithm extraction.
+//
+// A token that cannot be decoded is recorded as an audit.TokenValidationFailed event.
 func DecodeToken(tokenString string, key []byte) (*TokenBuilder, error) {
+	return DecodeTokenContext(context.Background(), tokenString, key)
+}
+
+// DecodeTokenContext decodes a token like DecodeToken, recording a span and metrics for the decoding (see the
+// telemetry package) and emitting any audit event with ctx's request and trace IDs.
+func DecodeTokenContext(ctx context.Context, tokenString string, key []byte) (*TokenBuilder, error) {
+	ctx, span := telemetry.Start(ctx, telemetry.TokenDecode, "")
+
+	b, err := decodeTokenBuilder(tokenString, key)
+	if err != nil {
+		span.End(err, telemetry.ReasonMalformed)
+		audit.Emit(ctx, audit.Event{
+			Type:   audit.TokenValidationFailed,
+			Source: auditSource,
+			Reason: fmt.Sprintf("failed to decode token: %v", err),
+		})
+		return nil, err
+	}
+
+	span.SetAlgorithm(b.algorithm())
+	span.End(nil, "")
+
+	return b, nil
+}
+
+func decodeTokenBuilder(tokenString string, key []byte) (*TokenBuilder, error) {
 	token, err := decodeToken(tokenString, key)
 	if err != nil {
 		return nil, err
@@ -105,6 +149,37 @@ func NewJWSToken(algorithmType common.AlgorithmType, key []byte) *TokenBuilder {
 	return b
 }
 
+// NewJWSTokenWithSigner creates a JWS token builder for an asymmetric algorithm (RS256 or ES256) that signs
+// with signer. Any crypto.Signer can be used, e.g. a key decoded once with crypto.DecodePrivateKey, or a
+// Cloud KMS, HSM or ssh-agent key. It returns nil if signer is nil.
+func NewJWSTokenWithSigner(algorithmType common.AlgorithmType, signer crypto.Signer) *TokenBuilder {
+	if signer == nil {
+		return nil
+	}
+
+	b := NewJWSToken(algorithmType, nil)
+	if b == nil {
+		return nil
+	}
+
+	return b.WithSigner(signer)
+}
+
+// NewJWETokenWithDecrypter creates a JWE token builder that encrypts to decrypter.Public() and decrypts
+// with decrypter. It returns nil if decrypter is nil.
+func NewJWETokenWithDecrypter(suite common.AlgorithmSuite, decrypter crypto.Decrypter) *TokenBuilder {
+	if decrypter == nil {
+		return nil
+	}
+
+	b := NewJWEToken(suite, nil)
+	if b == nil {
+		return nil
+	}
+
+	return b.WithDecrypter(decrypter)
+}
+
 func (b *TokenBuilder) GetClaims() common.ClaimSet {
 	switch b.token.TokenType {
 	case common.JWE:
@@ -118,7 +193,25 @@ func (b *TokenBuilder) GetClaims() common.ClaimSet {
 	return nil
 }
 
+// AddClaims sets the claims of the token being built to a copy of claims, so that the same claim set can be
+// used for several tokens. If the claim set has no "jti" claim, a random one is generated and added to the
+// copy so that the token can later be revoked. If it cannot be generated, Serialize returns the error.
 func (b *TokenBuilder) AddClaims(claims common.ClaimSet) *TokenBuilder {
+	copied := common.NewClaimSet()
+	for key, value := range claims {
+		copied[key] = value
+	}
+	claims = copied
+
+	if _, found := claims[string(common.JwtID)]; !found {
+		jti, err := common.NewJwtID()
+		if err != nil {
+			b.err = fmt.Errorf("failed to generate jti claim: %w", err)
+		} else {
+			claims[string(common.JwtID)] = jti
+		}
+	}
+
 	switch b.token.TokenType {
 	case common.JWE:
 		instance := b.token.TokenInstance.(*jwe.Token)
@@ -135,10 +228,289 @@ func (b *TokenBuilder) AddClaims(claims common.ClaimSet) *TokenBuilder {
 	return b
 }
 
+// WithSigner makes the token sign (and verify) with signer instead of the PEM key it was created or decoded
+// with. It applies to RS256 and ES256 JWS tokens.
+func (b *TokenBuilder) WithSigner(signer crypto.Signer) *TokenBuilder {
+	if b.token.TokenType == common.JWS {
+		b.token.TokenInstance.(*jws.Token).Signer = signer
+	}
+	return b
+}
+
+// WithDecrypter makes a JWE token decrypt its content encryption key with decrypter instead of a PEM
+// private key. When building a token without a public key, it is encrypted to decrypter.Public().
+func (b *TokenBuilder) WithDecrypter(decrypter crypto.Decrypter) *TokenBuilder {
+	if b.token.TokenType == common.JWE {
+		b.token.TokenInstance.(*jwe.Token).Decrypter = decrypter
+	}
+	return b
+}
+
+// WithRevocationStore makes Validate reject tokens whose "jti" has been revoked in store.
+// Tokens without a "jti" claim cannot be checked and are rejected once a store is set.
+func (b *TokenBuilder) WithRevocationStore(store RevocationStore) *TokenBuilder {
+	b.revocationStore = store
+	return b
+}
+
+// SingleUse marks the token being built as usable only once by adding the SingleUseClaim.
+// It must be called after AddClaims, and the token should carry an "exp" claim.
+func (b *TokenBuilder) SingleUse() *TokenBuilder {
+	if claims := b.GetClaims(); claims != nil {
+		claims[SingleUseClaim] = true
+	}
+	return b
+}
+
+// RequireAlgorithm makes Validate reject tokens whose header names any algorithm other than algorithm. The header
+// is chosen by whoever created the token, so tokens from untrusted sources must have their algorithm pinned,
+// otherwise a token with the "none" algorithm is accepted without a signature. Requiring common.None rejects
+// every token.
+func (b *TokenBuilder) RequireAlgorithm(algorithm common.AlgorithmType) *TokenBuilder {
+	b.requiredAlgorithm = &common.AlgorithmSuite{AlgorithmType: algorithm}
+	return b
+}
+
+// RequireAlgorithmSuite makes Validate reject tokens other than JWEs whose header names exactly suite's key
+// management and content encryption algorithms.
+func (b *TokenBuilder) RequireAlgorithmSuite(suite common.AlgorithmSuite) *TokenBuilder {
+	b.requiredAlgorithm = &suite
+	return b
+}
+
+// WithoutAuditTokenID omits the token's "jti" claim from the audit events recorded for it, even in hashed form,
+// e.g. for refresh tokens, which should leave no trace that could be used to look them up.
+func (b *TokenBuilder) WithoutAuditTokenID() *TokenBuilder {
+	b.omitAuditTokenID = true
+	return b
+}
+
+// WithReplayCache makes Validate accept tokens carrying the SingleUseClaim only on their first
+// presentation. Single-use tokens must carry both "jti" and "exp" claims to be accepted, and are always
+// rejected when no replay cache is set.
+func (b *TokenBuilder) WithReplayCache(cache ReplayCache) *TokenBuilder {
+	b.replayCache = cache
+	return b
+}
+
 func (b *TokenBuilder) Validate() (bool, error) {
-	return b.token.TokenInstance.Validate()
+	return b.ValidateContext(context.Background())
+}
+
+// ValidateContext validates the token like Validate, passing ctx to any configured stores. The outcome is
+// recorded as an audit.TokenValidated or audit.TokenValidationFailed event with ctx's request and trace IDs,
+// and as a span and metrics (see the telemetry package).
+func (b *TokenBuilder) ValidateContext(ctx context.Context) (bool, error) {
+	ctx, span := telemetry.Start(ctx, telemetry.TokenValidate, b.algorithm())
+	valid, err := b.validate(ctx)
+	if err == nil && !valid {
+		span.End(errors.New("token is invalid"), telemetry.ReasonInvalid)
+	} else {
+		span.End(err, failureReason(err))
+	}
+
+	event := audit.Event{Type: audit.TokenValidated, Source: auditSource, Algorithm: b.algorithm()}
+	switch {
+	case err != nil:
+		event.Type, event.Reason = audit.TokenValidationFailed, err.Error()
+	case !valid:
+		event.Type, event.Reason = audit.TokenValidationFailed, "token is invalid"
+	default:
+		event.Subject, _ = b.GetClaims().GetString(string(common.Subject))
+		event.TokenID = b.auditTokenID()
+	}
+	audit.Emit(ctx, event)
+
+	return valid, err
+}
+
+func (b *TokenBuilder) validate(ctx context.Context) (bool, error) {
+	if b.requiredAlgorithm != nil && !b.hasAlgorithm(*b.requiredAlgorithm) {
+		return false, ErrUnexpectedAlgorithm
+	}
+
+	valid, err := b.validateInstance(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if b.revocationStore != nil {
+		jti, found := b.GetClaims().JwtID()
+		if !found {
+			return false, errors.New("token has no jti claim and cannot be checked for revocation")
+		}
+
+		revoked, err := b.revocationStore.IsRevoked(ctx, jti)
+		if err != nil {
+			return false, fmt.Errorf("failed to check token revocation: %w", err)
+		}
+
+		if revoked {
+			return false, ErrTokenRevoked
+		}
+	}
+
+	if b.GetClaims()[SingleUseClaim] == true {
+		if err := b.consumeSingleUse(ctx); err != nil {
+			return false, err
+		}
+	}
+
+	return valid, nil
+}
+
+// hasAlgorithm reports whether the token is a JWE encrypted with suite, or a JWS signed with suite's algorithm
+// when it has no content encryption algorithm. The "none" algorithm never matches.
+func (b *TokenBuilder) hasAlgorithm(suite common.AlgorithmSuite) bool {
+	if suite.AlgorithmType == "" || suite.AlgorithmType == common.None || b.algSuite != suite {
+		return false
+	}
+
+	if suite.AuthAlgorithmType == "" {
+		return b.token.TokenType == common.JWS
+	}
+	return b.token.TokenType == common.JWE
+}
+
+// validateInstance verifies the token's signature, or decrypts it, and checks its expiration. Decryption is
+// recorded as a telemetry.JWEDecrypt span.
+func (b *TokenBuilder) validateInstance(ctx context.Context) (bool, error) {
+	if b.token.TokenType != common.JWE {
+		return b.token.TokenInstance.Validate()
+	}
+
+	_, span := telemetry.Start(ctx, telemetry.JWEDecrypt, b.algorithm())
+	valid, err := b.token.TokenInstance.Validate()
+	span.End(err, failureReason(err))
+
+	return valid, err
+}
+
+// failureReason classifies a validation error for telemetry.
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, common.ErrTokenExpired):
+		return telemetry.ReasonExpired
+	case errors.Is(err, ErrTokenRevoked):
+		return telemetry.ReasonRevoked
+	case errors.Is(err, ErrTokenReplayed):
+		return telemetry.ReasonReplayed
+	default:
+		return telemetry.ReasonInvalid
+	}
+}
+
+func (b *TokenBuilder) consumeSingleUse(ctx context.Context) error {
+	if b.replayCache == nil {
+		return errors.New("single-use token cannot be accepted without a replay cache")
+	}
+
+	claims := b.GetClaims()
+	jti, found := claims.JwtID()
+	if !found {
+		return errors.New("single-use token has no jti claim")
+	}
+
+	expiresAt, found := claims.ExpiresAt()
+	if !found {
+		return errors.New("single-use token has no exp claim")
+	}
+
+	firstUse, err := b.replayCache.MarkUsed(ctx, jti, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record single-use token: %w", err)
+	}
+
+	if !firstUse {
+		return ErrTokenReplayed
+	}
+
+	return nil
+}
+
+// Revoke records the token's "jti" in store until the token's expiration time.
+// For JWE tokens, Validate must be called first so that the claims have been decrypted.
+func (b *TokenBuilder) Revoke(ctx context.Context, store RevocationStore) error {
+	claims := b.GetClaims()
+	jti, found := claims.JwtID()
+	if !found {
+		return errors.New("token has no jti claim and cannot be revoked")
+	}
+
+	expiresAt, _ := claims.ExpiresAt()
+
+	return store.Revoke(ctx, jti, expiresAt)
 }
 
 func (b *TokenBuilder) Serialize() (string, error) {
-	return b.token.TokenInstance.Encode()
+	return b.SerializeContext(context.Background())
+}
+
+// SerializeContext serializes the token like Serialize, recording an audit.TokenIssued event with ctx's request
+// and trace IDs, and a span and metrics (see the telemetry package).
+func (b *TokenBuilder) SerializeContext(ctx context.Context) (string, error) {
+	ctx, span := telemetry.Start(ctx, telemetry.TokenSerialize, b.algorithm())
+	token, err := b.encode(ctx)
+	span.End(err, "")
+	if err != nil {
+		return "", err
+	}
+
+	subject, _ := b.GetClaims().GetString(string(common.Subject))
+	audit.Emit(ctx, audit.Event{
+		Type:      audit.TokenIssued,
+		Source:    auditSource,
+		Subject:   subject,
+		TokenID:   b.auditTokenID(),
+		Algorithm: b.algorithm(),
+	})
+
+	return token, nil
+}
+
+// encode signs or encrypts the token. Encryption is recorded as a telemetry.JWEEncrypt span.
+func (b *TokenBuilder) encode(ctx context.Context) (string, error) {
+	if b.err != nil {
+		return "", b.err
+	}
+
+	if b.token.TokenType != common.JWE {
+		return b.token.TokenInstance.Encode()
+	}
+
+	_, span := telemetry.Start(ctx, telemetry.JWEEncrypt, b.algorithm())
+	token, err := b.token.TokenInstance.Encode()
+	span.End(err, "")
+
+	return token, err
+}
+
+// auditSource identifies the events emitted by this package.
+const auditSource = "jwt"
+
+// auditTokenID returns the TokenID recorded in audit events: a hash of the "jti" claim, or nothing if it is
+// omitted with WithoutAuditTokenID.
+func (b *TokenBuilder) auditTokenID() string {
+	jti, found := b.GetClaims().JwtID()
+	if !found || b.omitAuditTokenID {
+		return ""
+	}
+	return audit.HashTokenID(jti)
+}
+
+// algorithm describes the token's algorithms for audit events and telemetry, e.g. "RS256" or "RSA-OAEP/A256GCM".
+// A decoded token's algorithms are read from its unauthenticated header, so any that armor does not support are
+// reported as telemetry.UnknownAlgorithm.
+func (b *TokenBuilder) algorithm() string {
+	if b.algSuite.AuthAlgorithmType != "" {
+		if !common.JweAlgorithmsMap[b.algSuite.AlgorithmType] || !common.JweAuthAlgorithmsMap[b.algSuite.AuthAlgorithmType] {
+			return telemetry.UnknownAlgorithm
+		}
+		return fmt.Sprintf("%s/%s", b.algSuite.AlgorithmType, b.algSuite.AuthAlgorithmType)
+	}
+
+	if !common.JwsAlgorithmsMap[b.algSuite.AlgorithmType] {
+		return telemetry.UnknownAlgorithm
+	}
+	return string(b.algSuite.AlgorithmType)
 }
@@ -1,12 +1,19 @@
 package common
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
+	"time"
 )
 
+// ErrTokenExpired is returned when validating a token whose "exp" claim is in the past.
+var ErrTokenExpired = errors.New("token has expired")
+
 type ClaimSet map[string]interface{}
 type RegisteredClaim string
 
@@ -18,12 +25,25 @@ const (
 	NotBefore      RegisteredClaim = "nbf"
 	IssuedAt       RegisteredClaim = "iat"
 	JwtID          RegisteredClaim = "jti"
+	Scope          RegisteredClaim = "scope"
+	Roles          RegisteredClaim = "roles"
+	Groups         RegisteredClaim = "groups"
 )
 
 func NewClaimSet() ClaimSet {
 	return ClaimSet{}
 }
 
+// NewJwtID generates a random, URL-safe value suitable for the "jti" claim.
+func NewJwtID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 func (c *ClaimSet) Add(key string, value interface{}) error {
 	_, found := (*c)[key]
 	if found {
@@ -83,3 +103,115 @@ func (c *ClaimSet) UnmarshalJSON(data []byte) error {
 
 	return nil
 }
+
+// GetString returns the claim stored under key if it is present and is a string.
+func (c ClaimSet) GetString(key string) (string, bool) {
+	value, ok := c[key].(string)
+	return value, ok
+}
+
+// GetStrings returns the claim stored under key as a slice of strings.
+//
+// Array claims (e.g. "roles" or "groups") are returned element by element, ignoring any
+// non-string members. String claims are treated as a space-delimited list, which is how
+// the "scope" claim is transmitted (RFC 8693, section 4.2). A missing claim yields nil.
+func (c ClaimSet) GetStrings(key string) []string {
+	switch value := c[key].(type) {
+	case string:
+		return strings.Fields(value)
+	case []string:
+		return value
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
+
+// Scopes returns the space-delimited "scope" claim as a slice.
+func (c ClaimSet) Scopes() []string {
+	return c.GetStrings(string(Scope))
+}
+
+// Roles returns the "roles" claim as a slice.
+func (c ClaimSet) Roles() []string {
+	return c.GetStrings(string(Roles))
+}
+
+// Groups returns the "groups" claim as a slice.
+func (c ClaimSet) Groups() []string {
+	return c.GetStrings(string(Groups))
+}
+
+// Audience returns the "aud" claim as a slice.
+//
+// Unlike GetStrings, a string claim is a single audience and is never split on whitespace, and an array is only
+// accepted if every member is a string (RFC 7519, section 4.1.3). Any other value yields nil.
+func (c ClaimSet) Audience() []string {
+	switch value := c[string(Audience)].(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			s, ok := v.(string)
+			if !ok {
+				return nil
+			}
+			values = append(values, s)
+		}
+		return values
+	}
+
+	return nil
+}
+
+// GetTime returns the claim stored under key as a time.
+//
+// Both RFC 3339 strings (the format armor-go has historically used for "exp") and
+// NumericDate values (seconds since the epoch, as defined by RFC 7519) are accepted.
+// The second return value is false if the claim is missing or cannot be interpreted as a time.
+func (c ClaimSet) GetTime(key string) (time.Time, bool) {
+	switch value := c[key].(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return t, true
+	case float64:
+		return time.Unix(0, int64(value*float64(time.Second))), true
+	case int64:
+		return time.Unix(value, 0), true
+	case int:
+		return time.Unix(int64(value), 0), true
+	case json.Number:
+		seconds, err := value.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(0, int64(seconds*float64(time.Second))), true
+	case time.Time:
+		return value, true
+	}
+
+	return time.Time{}, false
+}
+
+// JwtID returns the "jti" claim, if present.
+func (c ClaimSet) JwtID() (string, bool) {
+	return c.GetString(string(JwtID))
+}
+
+// ExpiresAt returns the "exp" claim, if present.
+func (c ClaimSet) ExpiresAt() (time.Time, bool) {
+	return c.GetTime(string(ExpirationTime))
+}
@@ -15,6 +15,7 @@ const (
 	// JWS
 	HS256 AlgorithmType = "HS256"
 	RS256 AlgorithmType = "RS256"
+	ES256 AlgorithmType = "ES256"
 	None  AlgorithmType = "none"
 
 	// JWE
@@ -27,6 +28,7 @@ var (
 	JwsAlgorithmsMap = map[AlgorithmType]bool{
 		HS256: true,
 		RS256: true,
+		ES256: true,
 		None:  true,
 	}
 
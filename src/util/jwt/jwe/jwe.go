@@ -1,9 +1,11 @@
 package jwe
 
 import (
+	"crypto"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	armorCrypto "github.com/bmwadforth-com/armor-go/src/util/crypto"
 	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
 	"strings"
 	"time"
@@ -20,6 +22,10 @@ type Token struct {
 	Raw        string
 	PrivateKey []byte
 	PublicKey  []byte
+	// Decrypter decrypts the content encryption key. Any crypto.Decrypter can be used, including Cloud KMS
+	// or HSM keys. If it is nil, it is decoded from the PEM private key in PrivateKey the first time it is
+	// needed. If PublicKey is empty, tokens are encrypted to Decrypter.Public().
+	Decrypter crypto.Decrypter
 
 	encryptedKey []byte
 	iv           []byte
@@ -51,6 +57,21 @@ func New(alg common.AlgorithmSuite, claims common.ClaimSet, publicKey []byte) (*
 	return t, nil
 }
 
+// NewWithDecrypter creates a token that is encrypted to decrypter.Public() and decrypted with decrypter.
+func NewWithDecrypter(alg common.AlgorithmSuite, claims common.ClaimSet, decrypter crypto.Decrypter) (*Token, error) {
+	if decrypter == nil {
+		return nil, errors.New("decrypter must not be nil")
+	}
+
+	t, err := New(alg, claims, nil)
+	if err != nil {
+		return nil, err
+	}
+	t.Decrypter = decrypter
+
+	return t, nil
+}
+
 func (t *Token) Encode() (string, error) {
 	var err error
 	_, err = t.Header.Serialize()
@@ -69,7 +90,7 @@ func (t *Token) Encode() (string, error) {
 	}
 
 	parts := []string{
-		fmt.Sprintf("%s", t.Header.Metadata),
+		t.Header.Metadata.Base64,
 		base64.RawURLEncoding.EncodeToString(t.encryptedKey),
 		base64.RawURLEncoding.EncodeToString(t.iv),
 		base64.RawURLEncoding.EncodeToString(t.cipherText),
@@ -134,18 +155,41 @@ func (t *Token) Validate() (bool, error) {
 	}
 
 	//TODO: ValidateJws more claims
-	exp, ok := t.Payload.Data[string(common.ExpirationTime)]
+	_, ok := t.Payload.Data[string(common.ExpirationTime)]
 	if ok {
-		claim := exp.(string)
-		expiration, err := time.Parse(time.RFC3339, claim)
-		if err != nil {
-			return false, err
+		expiration, ok := t.Payload.Data.ExpiresAt()
+		if !ok {
+			return false, errors.New("exp claim is not a valid time")
 		}
 
 		if expiration.Before(time.Now()) {
-			return false, errors.New("token has expired")
+			return false, common.ErrTokenExpired
 		}
 	}
 
 	return valid, nil
 }
+
+// decrypter returns the token's Decrypter, decoding it from PrivateKey on first use.
+func (t *Token) decrypter() (crypto.Decrypter, error) {
+	if t.Decrypter != nil {
+		return t.Decrypter, nil
+	}
+
+	privateKey, err := armorCrypto.DecodeRsaPrivateKey(t.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	t.Decrypter = privateKey
+
+	return privateKey, nil
+}
+
+// additionalData returns the additional authenticated data of the content encryption: the ASCII bytes of the
+// base64url encoded protected header, as in the compact serialization (RFC 7516, section 5.1, step 14).
+//
+// Tokens encrypted before the header was serialized this way used the header JSON instead, and their header
+// segment was not valid base64url, so they cannot be decrypted and must be issued again.
+func (t *Token) additionalData() []byte {
+	return []byte(t.Header.Metadata.Base64)
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"errors"
 	"github.com/bmwadforth-com/armor-go/src/util/crypto"
 	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
 )
@@ -21,9 +22,19 @@ func getJweSignFunc(a common.AlgorithmSuite) SignFunc {
 }
 
 func signRSAOAEPA256GCM(t *Token, plaintext []byte) ([]byte, error) {
-	publicKey, err := crypto.DecodeRsaPublicKey(t.PublicKey)
-	if err != nil {
-		return nil, err
+	var publicKey *rsa.PublicKey
+	if len(t.PublicKey) == 0 && t.Decrypter != nil {
+		rsaKey, ok := t.Decrypter.Public().(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("RSA-OAEP requires an RSA key")
+		}
+		publicKey = rsaKey
+	} else {
+		rsaKey, err := crypto.DecodeRsaPublicKey(t.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		publicKey = rsaKey
 	}
 
 	keySize, err := t.Header.GetEncryptionAlgorithm()
@@ -36,7 +47,7 @@ func signRSAOAEPA256GCM(t *Token, plaintext []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	ciphertext, nonce, authTag, err := crypto.EncryptAESGCM(cek, plaintext, t.Header.Metadata.Bytes)
+	ciphertext, nonce, authTag, err := crypto.EncryptAESGCM(cek, plaintext, t.additionalData())
 	if err != nil {
 		return nil, err
 	}
@@ -1,13 +1,12 @@
 package jwe
 
 import (
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
 	"fmt"
-	"github.com/bmwadforth-com/armor-go/src/util/crypto"
 	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
 	"strings"
 )
@@ -25,12 +24,12 @@ func getJweValidateFunc(a common.AlgorithmSuite) ValidateFunc {
 }
 
 func validateRSAOAEPA256GCM(t *Token) (bool, error) {
-	privateKey, err := crypto.DecodeRsaPrivateKey(t.PrivateKey)
+	decrypter, err := t.decrypter()
 	if err != nil {
 		return false, err
 	}
 
-	plaintext, err := decryptJWE(t, privateKey)
+	plaintext, err := decryptJWE(t, decrypter)
 	if err != nil {
 		return false, err
 	}
@@ -43,13 +42,13 @@ func validateRSAOAEPA256GCM(t *Token) (bool, error) {
 	return true, nil
 }
 
-func decryptJWE(t *Token, privateKey *rsa.PrivateKey) ([]byte, error) {
+func decryptJWE(t *Token, decrypter crypto.Decrypter) ([]byte, error) {
 	parts := strings.Split(t.Raw, ".")
 	if len(parts) != 5 {
 		return nil, fmt.Errorf("invalid JWE format")
 	}
 
-	cek, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, t.encryptedKey, nil)
+	cek, err := decrypter.Decrypt(rand.Reader, t.encryptedKey, &rsa.OAEPOptions{Hash: crypto.SHA256})
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt CEK: %w", err)
 	}
@@ -64,7 +63,7 @@ func decryptJWE(t *Token, privateKey *rsa.PrivateKey) ([]byte, error) {
 	}
 
 	ciphertextWithTag := append(t.cipherText, t.authTag...)
-	plaintext, err := aesGCM.Open(nil, t.iv, ciphertextWithTag, t.Header.Metadata.Bytes)
+	plaintext, err := aesGCM.Open(nil, t.iv, ciphertextWithTag, t.additionalData())
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt payload: %w", err)
 	}
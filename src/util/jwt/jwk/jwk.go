@@ -0,0 +1,133 @@
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Key is a JSON Web Key (RFC 7517) holding a public key.
+type Key struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// RSA public key parameters.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Elliptic curve public key parameters.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// Set is a JSON Web Key Set, as served from an issuer's "jwks_uri".
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// NewRSAKey creates a Key for an RSA public key.
+func NewRSAKey(keyID string, algorithm string, publicKey *rsa.PublicKey) Key {
+	return Key{
+		KeyType:   "RSA",
+		KeyID:     keyID,
+		Use:       "sig",
+		Algorithm: algorithm,
+		N:         base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+	}
+}
+
+// NewECKey creates a Key for a P-256 ECDSA public key.
+func NewECKey(keyID string, algorithm string, publicKey *ecdsa.PublicKey) Key {
+	size := (publicKey.Curve.Params().BitSize + 7) / 8
+	return Key{
+		KeyType:   "EC",
+		KeyID:     keyID,
+		Use:       "sig",
+		Algorithm: algorithm,
+		Curve:     publicKey.Curve.Params().Name,
+		X:         base64.RawURLEncoding.EncodeToString(publicKey.X.FillBytes(make([]byte, size))),
+		Y:         base64.RawURLEncoding.EncodeToString(publicKey.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+// PublicKey decodes the key material into a crypto.PublicKey.
+//
+// Returns:
+//   - An *rsa.PublicKey for "RSA" keys, or an *ecdsa.PublicKey for "EC" P-256 keys.
+//   - An error if the key type is unsupported or the key parameters are malformed.
+func (k Key) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 2 {
+			return nil, errors.New("invalid RSA public key")
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exponent.Int64()),
+		}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve: %s", k.Curve)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+
+		publicKey := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, errors.New("invalid EC public key: point is not on curve")
+		}
+
+		return publicKey, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type: %s", k.KeyType)
+}
+
+// Lookup returns the keys in the set with the given key ID. If keyID is empty, every key is returned.
+func (s Set) Lookup(keyID string) []Key {
+	if keyID == "" {
+		return s.Keys
+	}
+
+	var keys []Key
+	for _, k := range s.Keys {
+		if k.KeyID == keyID {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
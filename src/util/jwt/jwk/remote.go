@@ -0,0 +1,162 @@
+package jwk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/util/audit"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrKeyNotFound is returned when no key in a set matches the requested key ID.
+var ErrKeyNotFound = errors.New("no matching key found in key set")
+
+const (
+	// remoteSetTTL is how long a fetched key set is used before it is fetched again.
+	remoteSetTTL = time.Hour
+	// remoteSetMinRefresh bounds how often an unknown key ID can trigger a fetch, so that tokens
+	// with made-up key IDs cannot be used to hammer the issuer.
+	remoteSetMinRefresh = 10 * time.Second
+)
+
+// RemoteSet is a JSON Web Key Set fetched from a URL and cached.
+//
+// The set is fetched again after an hour, or sooner when a token refers to a key ID that is not
+// in the cached set (issuers publish new keys before they start signing with them). A fetch that
+// changes the key IDs in the set is recorded as an audit.KeyRotated event.
+type RemoteSet struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	set       Set
+	fetchedAt time.Time
+}
+
+// NewRemoteSet creates a RemoteSet for the key set served at url. A nil client uses http.DefaultClient.
+func NewRemoteSet(url string, client *http.Client) *RemoteSet {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &RemoteSet{
+		url:    url,
+		client: client,
+	}
+}
+
+// Keys returns the keys matching keyID, fetching the key set if the cache is stale or has no match.
+//
+// Returns:
+//   - The matching keys.
+//   - ErrKeyNotFound if no key matches, or an error if the key set could not be fetched.
+func (r *RemoteSet) Keys(ctx context.Context, keyID string) ([]Key, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.fetchedAt.IsZero() || now.Sub(r.fetchedAt) >= remoteSetTTL {
+		if err := r.fetch(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := r.set.Lookup(keyID)
+	if len(keys) == 0 && now.Sub(r.fetchedAt) >= remoteSetMinRefresh {
+		if err := r.fetch(ctx); err != nil {
+			return nil, err
+		}
+		keys = r.set.Lookup(keyID)
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrKeyNotFound
+	}
+
+	return keys, nil
+}
+
+// Refresh fetches the key set now, e.g. when the issuer announces a key rotation.
+func (r *RemoteSet) Refresh(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.fetch(ctx)
+}
+
+func (r *RemoteSet) fetch(ctx context.Context) error {
+	set, err := Fetch(ctx, r.client, r.url)
+	if err != nil {
+		return err
+	}
+
+	// The first fetch is not a rotation.
+	if !r.fetchedAt.IsZero() && !sameKeyIDs(r.set, set) {
+		keyIDs := make([]string, 0, len(set.Keys))
+		for _, k := range set.Keys {
+			keyIDs = append(keyIDs, k.KeyID)
+		}
+
+		audit.Emit(ctx, audit.Event{
+			Type:   audit.KeyRotated,
+			Source: "jwk",
+			KeyIDs: keyIDs,
+			Reason: fmt.Sprintf("key set at %s changed", r.url),
+		})
+	}
+
+	r.set = set
+	r.fetchedAt = time.Now()
+
+	return nil
+}
+
+// sameKeyIDs reports whether both sets hold keys with the same IDs.
+func sameKeyIDs(a Set, b Set) bool {
+	if len(a.Keys) != len(b.Keys) {
+		return false
+	}
+
+	ids := map[string]int{}
+	for _, k := range a.Keys {
+		ids[k.KeyID]++
+	}
+	for _, k := range b.Keys {
+		if ids[k.KeyID] == 0 {
+			return false
+		}
+		ids[k.KeyID]--
+	}
+	return true
+}
+
+// Fetch downloads and decodes the key set served at url.
+func Fetch(ctx context.Context, client *http.Client, url string) (Set, error) {
+	var set Set
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return set, fmt.Errorf("failed to create key set request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return set, fmt.Errorf("failed to fetch key set: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return set, fmt.Errorf("failed to fetch key set: %s: %s", resp.Status, body)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return set, fmt.Errorf("failed to decode key set: %w", err)
+	}
+
+	return set, nil
+}
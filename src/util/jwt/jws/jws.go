@@ -1,9 +1,11 @@
 package jws
 
 import (
+	"crypto"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	armorCrypto "github.com/bmwadforth-com/armor-go/src/util/crypto"
 	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
 	"time"
 )
@@ -18,7 +20,11 @@ type Token struct {
 	SignFunc
 	ValidateFunc
 	Key []byte
-	Raw string
+	// Signer signs tokens for asymmetric algorithms (RS256, ES256), which are verified against Signer.Public().
+	// Any crypto.Signer can be used, including Cloud KMS, HSM or ssh-agent keys. If it is nil, it is decoded
+	// from the PEM private key in Key the first time it is needed.
+	Signer crypto.Signer
+	Raw    string
 }
 
 func New(alg common.AlgorithmType, claims common.ClaimSet, key []byte) (*Token, error) {
@@ -45,6 +51,21 @@ func New(alg common.AlgorithmType, claims common.ClaimSet, key []byte) (*Token,
 	return t, nil
 }
 
+// NewWithSigner creates a token for an asymmetric algorithm that is signed with signer.
+func NewWithSigner(alg common.AlgorithmType, claims common.ClaimSet, signer crypto.Signer) (*Token, error) {
+	if signer == nil {
+		return nil, errors.New("signer must not be nil")
+	}
+
+	t, err := New(alg, claims, nil)
+	if err != nil {
+		return nil, err
+	}
+	t.Signer = signer
+
+	return t, nil
+}
+
 func (t *Token) Encode() (string, error) {
 	var err error
 	_, err = t.Header.Serialize()
@@ -118,18 +139,32 @@ func (t *Token) Validate() (bool, error) {
 	}
 
 	//TODO: ValidateJws more claims
-	exp, ok := t.Payload.Data[string(common.ExpirationTime)]
+	_, ok := t.Payload.Data[string(common.ExpirationTime)]
 	if ok {
-		claim := exp.(string)
-		expiration, err := time.Parse(time.RFC3339, claim)
-		if err != nil {
-			return false, err
+		expiration, ok := t.Payload.Data.ExpiresAt()
+		if !ok {
+			return false, errors.New("exp claim is not a valid time")
 		}
 
 		if expiration.Before(time.Now()) {
-			return false, errors.New("token has expired")
+			return false, common.ErrTokenExpired
 		}
 	}
 
 	return valid, nil
 }
+
+// signer returns the token's Signer, decoding it from Key on first use.
+func (t *Token) signer() (crypto.Signer, error) {
+	if t.Signer != nil {
+		return t.Signer, nil
+	}
+
+	signer, err := armorCrypto.DecodePrivateKey(t.Key)
+	if err != nil {
+		return nil, err
+	}
+	t.Signer = signer
+
+	return signer, nil
+}
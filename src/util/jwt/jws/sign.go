@@ -2,12 +2,14 @@ package jws
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
-	"crypto/x509"
-	"encoding/pem"
+	"errors"
+	armorCrypto "github.com/bmwadforth-com/armor-go/src/util/crypto"
 	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
 )
 
@@ -17,6 +19,8 @@ func getJwsSignFunc(a common.AlgorithmType) SignFunc {
 		return signHMAC256
 	case common.RS256:
 		return signRSA256
+	case common.ES256:
+		return signES256
 	case common.None:
 		return func(_ *Token, _ []byte) ([]byte, error) {
 			return nil, nil
@@ -35,16 +39,36 @@ func signHMAC256(t *Token, signingInput []byte) ([]byte, error) {
 }
 
 func signRSA256(t *Token, signingInput []byte) ([]byte, error) {
-	block, _ := pem.Decode(t.Key)
-	key, _ := x509.ParsePKCS1PrivateKey(block.Bytes)
+	signer, err := t.signer()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		return nil, errors.New("RS256 requires an RSA key")
+	}
+
+	hashed := sha256.Sum256(signingInput)
+
+	return signer.Sign(rand.Reader, hashed[:], crypto.SHA256)
+}
+
+func signES256(t *Token, signingInput []byte) ([]byte, error) {
+	signer, err := t.signer()
+	if err != nil {
+		return nil, err
+	}
+
+	if publicKey, ok := signer.Public().(*ecdsa.PublicKey); !ok || publicKey.Curve != elliptic.P256() {
+		return nil, errors.New("ES256 requires an ECDSA P-256 key")
+	}
 
-	rng := rand.Reader
 	hashed := sha256.Sum256(signingInput)
 
-	signature, err := rsa.SignPKCS1v15(rng, key, crypto.SHA256, hashed[:])
+	der, err := signer.Sign(rand.Reader, hashed[:], crypto.SHA256)
 	if err != nil {
 		return nil, err
 	}
 
-	return signature, nil
+	return armorCrypto.ConvertECDSASignature(der, 32)
 }
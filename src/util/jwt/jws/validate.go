@@ -2,15 +2,16 @@ package jws
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/rsa"
 	"crypto/sha256"
-	"crypto/x509"
 	"encoding/base64"
-	"encoding/pem"
 	"errors"
 	"fmt"
 	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"math/big"
 	"strings"
 )
 
@@ -20,6 +21,8 @@ func getJwsValidateFunc(a common.AlgorithmType) ValidateFunc {
 		return validateHMAC256
 	case common.RS256:
 		return validateRSA256
+	case common.ES256:
+		return validateES256
 	case common.None:
 		return func(_ *Token) (bool, error) {
 			return true, nil
@@ -50,26 +53,73 @@ func validateHMAC256(t *Token) (bool, error) {
 }
 
 func validateRSA256(t *Token) (bool, error) {
-	block, _ := pem.Decode(t.Key)
-	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		return false, err
-	}
-
-	headerB64, _ := t.Header.Serialize()
-	payloadB64, _ := t.Payload.Serialize()
+	return validateAsymmetric(t, common.RS256)
+}
 
-	hashed := sha256.Sum256([]byte(fmt.Sprintf("%s.%s", headerB64, payloadB64)))
+func validateES256(t *Token) (bool, error) {
+	return validateAsymmetric(t, common.ES256)
+}
 
-	decodedSignature, err := base64.RawURLEncoding.DecodeString(t.Signature.Metadata.Base64)
+func validateAsymmetric(t *Token, alg common.AlgorithmType) (bool, error) {
+	signer, err := t.signer()
 	if err != nil {
 		return false, err
 	}
 
-	err = rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hashed[:], decodedSignature)
+	parts := strings.Split(t.Raw, ".")
+	if len(parts) != 3 {
+		return false, errors.New("invalid token format")
+	}
+
+	err = VerifySignature(alg, []byte(strings.Join(parts[:2], ".")), t.Signature.Metadata.Bytes, signer.Public())
 	if err != nil {
 		return false, err
 	}
 
 	return true, nil
 }
+
+// VerifySignature verifies a JWS signature using a public key, for tokens issued by a third party
+// where only the issuer's public key is available (e.g. from a JSON Web Key Set).
+//
+// Parameters:
+//   - alg: The algorithm from the token header.
+//   - signingInput: The encoded header and payload joined with ".".
+//   - signature: The decoded signature.
+//   - publicKey: The issuer's public key.
+//
+// Returns:
+//   - nil if the signature is valid, otherwise an error describing why verification failed.
+func VerifySignature(alg common.AlgorithmType, signingInput []byte, signature []byte, publicKey crypto.PublicKey) error {
+	switch alg {
+	case common.RS256:
+		rsaKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("RS256 requires an RSA public key")
+		}
+
+		hashed := sha256.Sum256(signingInput)
+		return rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, hashed[:], signature)
+	case common.ES256:
+		ecKey, ok := publicKey.(*ecdsa.PublicKey)
+		if !ok || ecKey.Curve != elliptic.P256() {
+			return errors.New("ES256 requires an ECDSA P-256 public key")
+		}
+
+		// JWS encodes ECDSA signatures as the fixed-width concatenation R || S (RFC 7518, section 3.4).
+		if len(signature) != 64 {
+			return errors.New("invalid ES256 signature length")
+		}
+
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		hashed := sha256.Sum256(signingInput)
+		if !ecdsa.Verify(ecKey, hashed[:], r, s) {
+			return errors.New("ES256 signature verification failed")
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unsupported algorithm for public key verification: %s", alg)
+}
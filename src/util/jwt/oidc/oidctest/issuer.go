@@ -0,0 +1,169 @@
+// Package oidctest provides a local OpenID Provider for testing code that verifies ID tokens.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jwk"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jws"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/oidc"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Issuer is a fake OpenID Provider served by an httptest.Server. It publishes a discovery
+// document and a JSON Web Key Set, and signs ID tokens with RS256 or ES256.
+type Issuer struct {
+	Server *httptest.Server
+	// MultiTenant publishes an issuer with a {tenantid} placeholder in the discovery document, like
+	// multi-tenant Entra ID. Tokens must then be issued by TenantURL. Set it before creating a Provider.
+	MultiTenant bool
+
+	algorithm common.AlgorithmType
+
+	mu     sync.Mutex
+	keyID  string
+	signer crypto.Signer
+	keys   []jwk.Key
+}
+
+// NewIssuer starts a fake issuer with a freshly generated RS256 signing key. Call Close when done.
+func NewIssuer() (*Issuer, error) {
+	return NewIssuerWithAlgorithm(common.RS256)
+}
+
+// NewIssuerWithAlgorithm starts a fake issuer that signs ID tokens with algorithm, either RS256 or ES256.
+// Call Close when done.
+func NewIssuerWithAlgorithm(algorithm common.AlgorithmType) (*Issuer, error) {
+	if algorithm != common.RS256 && algorithm != common.ES256 {
+		return nil, fmt.Errorf("unsupported issuer algorithm: %s", algorithm)
+	}
+
+	i := &Issuer{algorithm: algorithm}
+	if err := i.RotateKey(); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := i.URL()
+		if i.MultiTenant {
+			issuer = i.TenantURL("{tenantid}")
+		}
+
+		writeJson(w, oidc.Discovery{
+			Issuer:                           issuer,
+			AuthorizationEndpoint:            i.URL() + "/authorize",
+			TokenEndpoint:                    i.URL() + "/token",
+			JwksURI:                          i.JwksURL(),
+			IDTokenSigningAlgValuesSupported: []string{string(i.algorithm)},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		i.mu.Lock()
+		set := jwk.Set{Keys: append([]jwk.Key(nil), i.keys...)}
+		i.mu.Unlock()
+		writeJson(w, set)
+	})
+
+	i.Server = httptest.NewServer(mux)
+
+	return i, nil
+}
+
+// URL returns the issuer identifier, which is also the base URL of the server.
+func (i *Issuer) URL() string {
+	return i.Server.URL
+}
+
+// TenantURL returns the issuer of tokens from tenant when MultiTenant is set.
+func (i *Issuer) TenantURL(tenant string) string {
+	return i.Server.URL + "/" + tenant + "/v2.0"
+}
+
+// JwksURL returns the URL of the issuer's JSON Web Key Set.
+func (i *Issuer) JwksURL() string {
+	return i.Server.URL + "/jwks"
+}
+
+// Close shuts down the server.
+func (i *Issuer) Close() {
+	i.Server.Close()
+}
+
+// RotateKey generates a new signing key. The previous keys remain published in the key set.
+func (i *Issuer) RotateKey() error {
+	keyID, err := common.NewJwtID()
+	if err != nil {
+		return err
+	}
+
+	var signer crypto.Signer
+	var key jwk.Key
+	switch i.algorithm {
+	case common.ES256:
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		signer, key = privateKey, jwk.NewECKey(keyID, string(common.ES256), &privateKey.PublicKey)
+	default:
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return err
+		}
+		signer, key = privateKey, jwk.NewRSAKey(keyID, string(common.RS256), &privateKey.PublicKey)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.keyID = keyID
+	i.signer = signer
+	i.keys = append(i.keys, key)
+
+	return nil
+}
+
+// Claims returns a valid set of ID token claims for the given client and subject.
+// Callers can add or override claims before passing them to Sign.
+func (i *Issuer) Claims(clientID string, subject string) common.ClaimSet {
+	now := time.Now()
+	return common.ClaimSet{
+		string(common.Issuer):         i.URL(),
+		string(common.Subject):        subject,
+		string(common.Audience):       clientID,
+		string(common.IssuedAt):       now.Unix(),
+		string(common.ExpirationTime): now.Add(time.Hour).Unix(),
+		oidc.AuthTime:                 now.Unix(),
+	}
+}
+
+// Sign signs claims as an ID token with the issuer's algorithm and current key.
+func (i *Issuer) Sign(claims common.ClaimSet) (string, error) {
+	i.mu.Lock()
+	keyID := i.keyID
+	signer := i.signer
+	i.mu.Unlock()
+
+	token, err := jws.NewWithSigner(i.algorithm, claims, signer)
+	if err != nil {
+		return "", err
+	}
+	token.Header.Data["kid"] = keyID
+
+	return token.Encode()
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,108 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jwk"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Discovery is the subset of an OpenID Provider's metadata document
+// (/.well-known/openid-configuration) used to verify ID tokens.
+type Discovery struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint"`
+	JwksURI                          string   `json:"jwks_uri"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// Provider is an OpenID Provider whose discovery document has been loaded.
+type Provider struct {
+	Discovery Discovery
+	keySet    *jwk.RemoteSet
+}
+
+// tenantPlaceholder appears in the issuer of multi-tenant Entra ID discovery documents
+// (e.g. https://login.microsoftonline.com/{tenantid}/v2.0) and is replaced with the "tid" claim. Only tenants
+// permitted by Config.AllowedTenants or Config.AllowAnyTenant are accepted.
+const tenantPlaceholder = "{tenantid}"
+
+// NewProvider loads the discovery document of issuer and prepares its JSON Web Key Set.
+//
+// Parameters:
+//   - ctx: The context used for the discovery request.
+//   - issuer: The issuer URL, e.g. https://accounts.google.com. The discovery document is read from
+//     issuer + "/.well-known/openid-configuration".
+//   - client: The HTTP client used for discovery and key set requests. nil uses http.DefaultClient.
+//
+// Returns:
+//   - A pointer to the Provider.
+//   - An error if the discovery document cannot be loaded, has no jwks_uri, or names a different issuer.
+func NewProvider(ctx context.Context, issuer string, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("failed to fetch discovery document: %s: %s", resp.Status, body)
+	}
+
+	var discovery Discovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery document: %w", err)
+	}
+
+	if discovery.JwksURI == "" {
+		return nil, fmt.Errorf("discovery document for %s has no jwks_uri", issuer)
+	}
+
+	if discovery.Issuer != strings.TrimSuffix(issuer, "/") && discovery.Issuer != issuer &&
+		!(strings.Contains(discovery.Issuer, tenantPlaceholder) && sameOrigin(discovery.Issuer, issuer)) {
+		return nil, fmt.Errorf("discovery document issuer %q does not match %q", discovery.Issuer, issuer)
+	}
+
+	return &Provider{
+		Discovery: discovery,
+		keySet:    jwk.NewRemoteSet(discovery.JwksURI, client),
+	}, nil
+}
+
+// Verifier returns a Verifier for ID tokens issued by the provider to the client in config.
+func (p *Provider) Verifier(config Config) *Verifier {
+	return newVerifier(p.Discovery.Issuer, p.keySet, config)
+}
+
+// sameOrigin reports whether a and b are URLs with the same scheme and host, so that a multi-tenant discovery
+// document can only name issuers served by the host it was fetched from.
+func sameOrigin(a string, b string) bool {
+	urlA, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+
+	urlB, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	return urlA.Scheme == urlB.Scheme && urlA.Host != "" && urlA.Host == urlB.Host
+}
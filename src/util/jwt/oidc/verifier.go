@@ -0,0 +1,360 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jwk"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jws"
+	"hash"
+	"strings"
+	"time"
+)
+
+const (
+	// Nonce is the ID token claim echoing the nonce sent in the authentication request.
+	Nonce = "nonce"
+	// AuthTime is the ID token claim holding when the end user authenticated.
+	AuthTime = "auth_time"
+	// AuthorizedParty is the ID token claim naming the client the token was issued to.
+	AuthorizedParty = "azp"
+	// AccessTokenHash is the ID token claim binding it to an access token.
+	AccessTokenHash = "at_hash"
+	// CodeHash is the ID token claim binding it to an authorization code.
+	CodeHash = "c_hash"
+	// TenantID is the Entra ID claim identifying the tenant that issued the token.
+	TenantID = "tid"
+)
+
+// Config configures how a Verifier validates ID tokens.
+type Config struct {
+	// ClientID is the client the ID token must be issued to. It must appear in "aud".
+	ClientID string
+	// SupportedAlgorithms restricts the accepted signing algorithms. Defaults to RS256.
+	SupportedAlgorithms []common.AlgorithmType
+	// ClockSkew is the tolerance applied to "exp", "iat" and "auth_time". Defaults to one minute.
+	ClockSkew time.Duration
+	// MaxAge, when set, rejects tokens whose "auth_time" is older than MaxAge.
+	MaxAge time.Duration
+	// AllowedTenants lists the "tid" values accepted from a multi-tenant issuer, i.e. one whose discovery
+	// document has a {tenantid} placeholder in its issuer. It is ignored for single-tenant issuers.
+	AllowedTenants []string
+	// AllowAnyTenant accepts tokens from every tenant of a multi-tenant issuer. Without it (or AllowedTenants)
+	// such tokens are rejected, because any organisation can create a tenant and sign its users in.
+	AllowAnyTenant bool
+}
+
+// IDToken is a verified OpenID Connect ID token.
+type IDToken struct {
+	Issuer          string
+	Subject         string
+	Audience        []string
+	AuthorizedParty string
+	Expiry          time.Time
+	IssuedAt        time.Time
+	AuthTime        time.Time
+	Nonce           string
+	Claims          common.ClaimSet
+}
+
+// VerifyOption supplies request-specific values an ID token must be bound to.
+type VerifyOption func(*verifyOptions)
+
+type verifyOptions struct {
+	nonce       string
+	accessToken string
+	code        string
+}
+
+// WithNonce requires the "nonce" claim to equal nonce.
+func WithNonce(nonce string) VerifyOption {
+	return func(o *verifyOptions) {
+		o.nonce = nonce
+	}
+}
+
+// WithAccessToken requires the "at_hash" claim to be present and match accessToken.
+func WithAccessToken(accessToken string) VerifyOption {
+	return func(o *verifyOptions) {
+		o.accessToken = accessToken
+	}
+}
+
+// WithCode requires the "c_hash" claim to be present and match the authorization code.
+func WithCode(code string) VerifyOption {
+	return func(o *verifyOptions) {
+		o.code = code
+	}
+}
+
+// Verifier validates ID tokens for a single client of a single issuer.
+type Verifier struct {
+	issuer string
+	keySet *jwk.RemoteSet
+	config Config
+}
+
+func newVerifier(issuer string, keySet *jwk.RemoteSet, config Config) *Verifier {
+	if len(config.SupportedAlgorithms) == 0 {
+		config.SupportedAlgorithms = []common.AlgorithmType{common.RS256}
+	}
+
+	if config.ClockSkew == 0 {
+		config.ClockSkew = time.Minute
+	}
+
+	return &Verifier{
+		issuer: issuer,
+		keySet: keySet,
+		config: config,
+	}
+}
+
+// Verify parses rawIDToken, verifies its signature against the issuer's key set and validates its claims.
+//
+// Parameters:
+//   - ctx: The context used if the issuer's key set has to be fetched.
+//   - rawIDToken: The compact serialized ID token.
+//   - opts: Request-specific bindings such as WithNonce, WithAccessToken and WithCode.
+//
+// Returns:
+//   - The verified IDToken.
+//   - An error describing the first check that failed.
+func (v *Verifier) Verify(ctx context.Context, rawIDToken string, opts ...VerifyOption) (*IDToken, error) {
+	options := verifyOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid ID token format: expected a signed JWT")
+	}
+
+	token := new(jws.Token)
+	if err := token.Decode(parts); err != nil {
+		return nil, fmt.Errorf("failed to decode ID token: %w", err)
+	}
+
+	alg, err := token.Header.GetAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+
+	if !v.algorithmSupported(alg) {
+		return nil, fmt.Errorf("ID token signed with unsupported algorithm: %s", alg)
+	}
+
+	if err := v.verifySignature(ctx, token, alg, parts); err != nil {
+		return nil, err
+	}
+
+	claims := token.Payload.Data
+	idToken, err := v.validateClaims(claims, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyHash(claims, AccessTokenHash, options.accessToken, alg); err != nil {
+		return nil, err
+	}
+
+	if err := verifyHash(claims, CodeHash, options.code, alg); err != nil {
+		return nil, err
+	}
+
+	return idToken, nil
+}
+
+func (v *Verifier) algorithmSupported(alg common.AlgorithmType) bool {
+	for _, supported := range v.config.SupportedAlgorithms {
+		if alg == supported && alg != common.None {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *Verifier) verifySignature(ctx context.Context, token *jws.Token, alg common.AlgorithmType, parts []string) error {
+	keyID, _ := token.Header.Data["kid"].(string)
+	keys, err := v.keySet.Keys(ctx, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to find ID token signing key: %w", err)
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	for _, key := range keys {
+		publicKey, err := key.PublicKey()
+		if err != nil {
+			continue
+		}
+
+		if jws.VerifySignature(alg, signingInput, token.Signature.Metadata.Bytes, publicKey) == nil {
+			return nil
+		}
+	}
+
+	return errors.New("ID token signature is invalid")
+}
+
+func (v *Verifier) validateClaims(claims common.ClaimSet, options verifyOptions) (*IDToken, error) {
+	now := time.Now()
+	skew := v.config.ClockSkew
+
+	idToken := &IDToken{
+		Audience: claims.Audience(),
+		Claims:   claims,
+	}
+	idToken.Issuer, _ = claims.GetString(string(common.Issuer))
+	idToken.Subject, _ = claims.GetString(string(common.Subject))
+	idToken.AuthorizedParty, _ = claims.GetString(AuthorizedParty)
+	idToken.Nonce, _ = claims.GetString(Nonce)
+
+	expectedIssuer := v.issuer
+	if strings.Contains(expectedIssuer, tenantPlaceholder) {
+		tenant, _ := claims.GetString(TenantID)
+		if !v.tenantAllowed(tenant) {
+			return nil, fmt.Errorf("ID token tenant %q is not allowed", tenant)
+		}
+		expectedIssuer = strings.ReplaceAll(expectedIssuer, tenantPlaceholder, tenant)
+	}
+
+	if idToken.Issuer != expectedIssuer {
+		return nil, fmt.Errorf("ID token issued by %q, expected %q", idToken.Issuer, expectedIssuer)
+	}
+
+	if idToken.Subject == "" {
+		return nil, errors.New("ID token has no sub claim")
+	}
+
+	if !contains(idToken.Audience, v.config.ClientID) {
+		return nil, fmt.Errorf("ID token audience %v does not include %q", idToken.Audience, v.config.ClientID)
+	}
+
+	if idToken.AuthorizedParty != "" && idToken.AuthorizedParty != v.config.ClientID {
+		return nil, fmt.Errorf("ID token authorized party %q is not %q", idToken.AuthorizedParty, v.config.ClientID)
+	}
+
+	if len(idToken.Audience) > 1 && idToken.AuthorizedParty == "" {
+		return nil, errors.New("ID token has multiple audiences but no azp claim")
+	}
+
+	var found bool
+	idToken.Expiry, found = claims.ExpiresAt()
+	if !found {
+		return nil, errors.New("ID token has no valid exp claim")
+	}
+
+	if !now.Before(idToken.Expiry.Add(skew)) {
+		return nil, errors.New("ID token has expired")
+	}
+
+	idToken.IssuedAt, found = claims.GetTime(string(common.IssuedAt))
+	if !found {
+		return nil, errors.New("ID token has no valid iat claim")
+	}
+
+	if idToken.IssuedAt.After(now.Add(skew)) {
+		return nil, errors.New("ID token was issued in the future")
+	}
+
+	idToken.AuthTime, found = claims.GetTime(AuthTime)
+	if v.config.MaxAge > 0 {
+		if !found {
+			return nil, errors.New("ID token has no auth_time claim but a max age is required")
+		}
+
+		if now.Sub(idToken.AuthTime) > v.config.MaxAge+skew {
+			return nil, errors.New("ID token authentication is older than the allowed max age")
+		}
+	}
+
+	if options.nonce != "" && subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(options.nonce)) != 1 {
+		return nil, errors.New("ID token nonce does not match")
+	}
+
+	return idToken, nil
+}
+
+func (v *Verifier) tenantAllowed(tenant string) bool {
+	if tenant == "" {
+		return false
+	}
+
+	return v.config.AllowAnyTenant || contains(v.config.AllowedTenants, tenant)
+}
+
+// verifyHash checks an at_hash or c_hash claim: the base64url encoding of the left-most half of
+// the hash of value, using the hash function of the token's signing algorithm. The claim is only checked when
+// the caller supplied value, and must then be present.
+func verifyHash(claims common.ClaimSet, claim string, value string, alg common.AlgorithmType) error {
+	if value == "" {
+		return nil
+	}
+
+	expected, found := claims.GetString(claim)
+	if !found {
+		return fmt.Errorf("ID token has no %s claim to bind it to", claim)
+	}
+
+	actual, err := TokenHash(alg, value)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(actual), []byte(expected)) != 1 {
+		return fmt.Errorf("ID token %s does not match", claim)
+	}
+
+	return nil
+}
+
+// TokenHash computes the at_hash or c_hash value for an access token or authorization code.
+//
+// The hash function is the one used by the ID token's signing algorithm, chosen by its bit size: SHA-256 for
+// RS256, ES256, PS256 and HS256, SHA-384 for the *384 variants and SHA-512 for the *512 variants.
+func TokenHash(alg common.AlgorithmType, value string) (string, error) {
+	family, size := "", ""
+	if name := string(alg); len(name) == 5 {
+		family, size = name[:2], name[2:]
+	}
+
+	switch family {
+	case "RS", "ES", "PS", "HS":
+	default:
+		return "", fmt.Errorf("no token hash defined for algorithm %s", alg)
+	}
+
+	var h hash.Hash
+	switch size {
+	case "256":
+		h = sha256.New()
+	case "384":
+		h = sha512.New384()
+	case "512":
+		h = sha512.New()
+	default:
+		return "", fmt.Errorf("no token hash defined for algorithm %s", alg)
+	}
+
+	h.Write([]byte(value))
+	sum := h.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
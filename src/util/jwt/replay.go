@@ -0,0 +1,96 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// SingleUseClaim is the private claim that marks a token as usable only once.
+const SingleUseClaim = "single_use"
+
+// ErrReplayCacheFull is returned by MemoryReplayCache when it is at capacity and none of
+// its entries have expired. The token is rejected rather than risk accepting a replay.
+var ErrReplayCacheFull = errors.New("replay cache is full")
+
+// ErrTokenReplayed is returned by Validate when a single-use token is presented again.
+var ErrTokenReplayed = errors.New("token has already been used")
+
+// ReplayCache records the "jti" of single-use tokens that have been presented.
+//
+// Implementations backed by a shared store must perform MarkUsed atomically (e.g. Redis SET NX
+// with an expiry at expiresAt), otherwise two concurrent presentations can both succeed.
+type ReplayCache interface {
+	// MarkUsed records jti as used until expiresAt. It returns false if jti had already been recorded.
+	MarkUsed(ctx context.Context, jti string, expiresAt time.Time) (bool, error)
+}
+
+// MemoryReplayCache is an in-process ReplayCache, optionally holding at most a fixed number of entries.
+// Entries are evicted once the token they refer to has expired.
+type MemoryReplayCache struct {
+	mu         sync.Mutex
+	entries    map[string]time.Time
+	maxEntries int
+	lastSweep  time.Time
+	sweepAt    int
+}
+
+// minReplaySweepEntries is the smallest number of entries at which MarkUsed scans the cache for expired entries
+// before memorySweepInterval has passed.
+const minReplaySweepEntries = 64
+
+// NewMemoryReplayCache creates a MemoryReplayCache that holds at most maxEntries unexpired tokens. A maxEntries
+// of zero or less leaves the number of unexpired tokens unbounded. Either way, expired entries are swept at least
+// every minute and whenever the cache has doubled in size since the last sweep.
+func NewMemoryReplayCache(maxEntries int) *MemoryReplayCache {
+	return &MemoryReplayCache{
+		entries:    map[string]time.Time{},
+		maxEntries: maxEntries,
+	}
+}
+
+func (c *MemoryReplayCache) MarkUsed(_ context.Context, jti string, expiresAt time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if usedUntil, found := c.entries[jti]; found {
+		if now.Before(usedUntil) {
+			return false, nil
+		}
+		delete(c.entries, jti)
+	}
+
+	full := c.maxEntries > 0 && len(c.entries) >= c.maxEntries
+	if full || len(c.entries) >= c.sweepAt || now.Sub(c.lastSweep) >= memorySweepInterval {
+		c.evictExpired(now)
+	}
+
+	if c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		return false, ErrReplayCacheFull
+	}
+
+	c.entries[jti] = expiresAt
+
+	return true, nil
+}
+
+// Len returns the number of tokens currently recorded, including any not yet evicted.
+func (c *MemoryReplayCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+func (c *MemoryReplayCache) evictExpired(now time.Time) {
+	for jti, usedUntil := range c.entries {
+		if !now.Before(usedUntil) {
+			delete(c.entries, jti)
+		}
+	}
+
+	c.lastSweep = now
+	c.sweepAt = max(2*len(c.entries), minReplaySweepEntries)
+}
@@ -0,0 +1,91 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTokenRevoked is returned by Validate when the token's "jti" has been revoked.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// RevocationStore records revoked tokens by their "jti" claim.
+//
+// Implementations backed by a shared store (e.g. Redis or Memcached) should expire each
+// entry at expiresAt, since a token past its expiration is rejected regardless of revocation.
+type RevocationStore interface {
+	// Revoke marks the token identified by jti as revoked until expiresAt.
+	// A zero expiresAt means the revocation never expires.
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+
+	// IsRevoked reports whether the token identified by jti has been revoked.
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// MemoryRevocationStore is an in-process RevocationStore. Entries are evicted once the
+// token they refer to has expired.
+type MemoryRevocationStore struct {
+	mu        sync.Mutex
+	entries   map[string]time.Time
+	lastSweep time.Time
+}
+
+// memorySweepInterval is how often MemoryRevocationStore.Revoke and MemoryReplayCache.MarkUsed scan for expired
+// entries.
+const memorySweepInterval = time.Minute
+
+// NewMemoryRevocationStore creates an empty MemoryRevocationStore.
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		entries: map[string]time.Time{},
+	}
+}
+
+func (s *MemoryRevocationStore) Revoke(_ context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= memorySweepInterval {
+		s.evictExpired(now)
+		s.lastSweep = now
+	}
+
+	s.entries[jti] = expiresAt
+
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(_ context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, found := s.entries[jti]
+	if !found {
+		return false, nil
+	}
+
+	if !expiresAt.IsZero() && !time.Now().Before(expiresAt) {
+		delete(s.entries, jti)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Len returns the number of revocations currently held, including any not yet evicted.
+func (s *MemoryRevocationStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
+
+func (s *MemoryRevocationStore) evictExpired(now time.Time) {
+	for jti, expiresAt := range s.entries {
+		if !expiresAt.IsZero() && !now.Before(expiresAt) {
+			delete(s.entries, jti)
+		}
+	}
+}
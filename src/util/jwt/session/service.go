@@ -0,0 +1,406 @@
+package session
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/util/audit"
+	armorCrypto "github.com/bmwadforth-com/armor-go/src/util/crypto"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"time"
+)
+
+// RefreshTokenFormat selects how refresh tokens are represented to clients.
+type RefreshTokenFormat string
+
+const (
+	// Opaque refresh tokens are random strings. Only a hash of the token is kept in the RefreshStore.
+	Opaque RefreshTokenFormat = "opaque"
+	// JWE refresh tokens are encrypted tokens carrying a random secret and the family. Anyone holding the
+	// encryption key can create a JWE, so only the secret, never the "jti", identifies the refresh token.
+	JWE RefreshTokenFormat = "jwe"
+
+	// FamilyClaim is the private claim holding the refresh token family in JWE refresh tokens.
+	FamilyClaim = "fam"
+	// SecretClaim is the private claim holding the random secret that identifies a JWE refresh token. Only a
+	// hash of the secret is kept in the RefreshStore, as for opaque refresh tokens.
+	SecretClaim = "rts"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+	ErrRefreshTokenExpired = errors.New("refresh token has expired")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used; token family revoked")
+	ErrRefreshTokenRevoked = errors.New("refresh token has been revoked")
+)
+
+// Config configures a Service.
+type Config struct {
+	// SigningAlgorithm and SigningKey are used to sign access tokens, as with jwt.NewJWSToken. The algorithm
+	// must be HS256, RS256 or ES256.
+	SigningAlgorithm common.AlgorithmType
+	SigningKey       []byte
+	// Signer signs access tokens for RS256 and ES256 instead of SigningKey, and must hold an RSA or P-256 ECDSA
+	// key respectively. If it is nil, a PEM encoded SigningKey is decoded into a Signer once, when the Service
+	// is created.
+	Signer crypto.Signer
+
+	// AccessTokenTTL is the lifetime of access tokens. Defaults to 15 minutes.
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL is the lifetime of each refresh token. Defaults to 7 days.
+	RefreshTokenTTL time.Duration
+
+	// RefreshTokenFormat selects opaque or JWE refresh tokens. Defaults to Opaque.
+	RefreshTokenFormat RefreshTokenFormat
+	// RefreshEncryptionSuite, RefreshEncryptionKey and RefreshDecryptionKey are required for JWE
+	// refresh tokens. The keys are PEM encoded RSA public and private keys respectively.
+	RefreshEncryptionSuite common.AlgorithmSuite
+	RefreshEncryptionKey   []byte
+	RefreshDecryptionKey   []byte
+	// RefreshDecrypter can be set instead of RefreshDecryptionKey. If RefreshEncryptionKey is empty,
+	// refresh tokens are encrypted to RefreshDecrypter.Public().
+	RefreshDecrypter crypto.Decrypter
+
+	// Store holds refresh token state. Defaults to a MemoryRefreshStore.
+	Store RefreshStore
+}
+
+// TokenPair is an access token together with the refresh token that can renew it.
+type TokenPair struct {
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+	TokenType             string
+}
+
+// Service issues access and refresh token pairs and rotates refresh tokens.
+//
+// Every refresh token can be exchanged exactly once. Presenting a refresh token that has already
+// been exchanged is treated as theft: the whole family of refresh tokens descended from the same
+// login is revoked and the caller must log in again.
+type Service struct {
+	config Config
+}
+
+// NewService creates a Service from config, applying defaults for unset fields.
+//
+// Returns:
+//   - A pointer to the Service.
+//   - An error if the signing algorithm is not HS256, RS256 or ES256, the signing key is missing or does not
+//     match the algorithm, or the JWE refresh token settings are incomplete.
+func NewService(config Config) (*Service, error) {
+	switch config.SigningAlgorithm {
+	case common.HS256, common.RS256, common.ES256:
+	default:
+		return nil, fmt.Errorf("unsupported access token signing algorithm: %q", config.SigningAlgorithm)
+	}
+
+	switch {
+	case config.Signer != nil:
+		if config.SigningAlgorithm == common.HS256 {
+			return nil, errors.New("a signer can only be used with RS256 or ES256 access tokens")
+		}
+	case len(config.SigningKey) == 0:
+		return nil, errors.New("a signing key is required for access tokens")
+	case config.SigningAlgorithm == common.RS256 || config.SigningAlgorithm == common.ES256:
+		signer, err := armorCrypto.DecodePrivateKey(config.SigningKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode signing key: %w", err)
+		}
+		config.Signer = signer
+	}
+
+	if config.Signer != nil {
+		if err := checkSignerKey(config.SigningAlgorithm, config.Signer); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.AccessTokenTTL == 0 {
+		config.AccessTokenTTL = 15 * time.Minute
+	}
+
+	if config.RefreshTokenTTL == 0 {
+		config.RefreshTokenTTL = 7 * 24 * time.Hour
+	}
+
+	if config.RefreshTokenFormat == "" {
+		config.RefreshTokenFormat = Opaque
+	}
+
+	switch config.RefreshTokenFormat {
+	case Opaque:
+	case JWE:
+		if config.RefreshDecrypter == nil {
+			if len(config.RefreshEncryptionKey) == 0 || len(config.RefreshDecryptionKey) == 0 {
+				return nil, errors.New("JWE refresh tokens require both an encryption and a decryption key")
+			}
+
+			decrypter, err := armorCrypto.DecodeRsaPrivateKey(config.RefreshDecryptionKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode refresh token decryption key: %w", err)
+			}
+			config.RefreshDecrypter = decrypter
+		}
+		if config.RefreshEncryptionSuite == (common.AlgorithmSuite{}) {
+			config.RefreshEncryptionSuite = common.AlgorithmSuite{
+				AlgorithmType:     common.RSA_OAEP,
+				AuthAlgorithmType: common.A256GCM,
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported refresh token format: %s", config.RefreshTokenFormat)
+	}
+
+	if config.Store == nil {
+		config.Store = NewMemoryRefreshStore()
+	}
+
+	return &Service{config: config}, nil
+}
+
+// Issue starts a new refresh token family and returns its first token pair.
+//
+// Parameters:
+//   - ctx: The context passed to the RefreshStore.
+//   - claims: The claims to include in every access token issued for this login, e.g. "sub" and "scope".
+//     "exp", "iat" and "jti" are set by the Service.
+func (s *Service) Issue(ctx context.Context, claims common.ClaimSet) (*TokenPair, error) {
+	familyID, err := common.NewJwtID()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issue(ctx, familyID, baseClaims(claims))
+}
+
+// Refresh exchanges a refresh token for a new token pair, rotating the refresh token.
+//
+// Returns:
+//   - The new token pair.
+//   - ErrRefreshTokenInvalid, ErrRefreshTokenExpired or ErrRefreshTokenRevoked if the refresh token is
+//     not acceptable, or ErrRefreshTokenReused if it had already been exchanged.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	record, err := s.lookup(ctx, refreshToken)
+	if err != nil {
+		emitRefreshFailed(ctx, err)
+		return nil, err
+	}
+
+	firstUse, err := s.config.Store.MarkUsed(ctx, record.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark refresh token as used: %w", err)
+	}
+
+	if !firstUse {
+		emitRefreshFailed(ctx, ErrRefreshTokenReused)
+		if err := s.revokeFamily(ctx, record.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	return s.issue(ctx, record.FamilyID, record.Claims)
+}
+
+// Revoke revokes the family the refresh token belongs to, e.g. on logout.
+func (s *Service) Revoke(ctx context.Context, refreshToken string) error {
+	record, err := s.lookup(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+
+	return s.revokeFamily(ctx, record.FamilyID)
+}
+
+func (s *Service) issue(ctx context.Context, familyID string, claims common.ClaimSet) (*TokenPair, error) {
+	now := time.Now()
+	pair := &TokenPair{
+		AccessTokenExpiresAt:  now.Add(s.config.AccessTokenTTL),
+		RefreshTokenExpiresAt: now.Add(s.config.RefreshTokenTTL),
+		TokenType:             "Bearer",
+	}
+
+	accessClaims := baseClaims(claims)
+	accessClaims[string(common.IssuedAt)] = now.Format(time.RFC3339)
+	accessClaims[string(common.ExpirationTime)] = pair.AccessTokenExpiresAt.Format(time.RFC3339)
+
+	var tokenBuilder *jwt.TokenBuilder
+	if s.config.Signer != nil {
+		tokenBuilder = jwt.NewJWSTokenWithSigner(s.config.SigningAlgorithm, s.config.Signer)
+	} else {
+		tokenBuilder = jwt.NewJWSToken(s.config.SigningAlgorithm, s.config.SigningKey)
+	}
+	if tokenBuilder == nil {
+		return nil, fmt.Errorf("failed to create access token with algorithm %s", s.config.SigningAlgorithm)
+	}
+
+	accessToken, err := tokenBuilder.AddClaims(accessClaims).SerializeContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+	pair.AccessToken = accessToken
+
+	// The secret identifying the refresh token, kept only as a hash.
+	refreshSecret, err := common.NewJwtID()
+	if err != nil {
+		return nil, err
+	}
+
+	record := RefreshRecord{
+		FamilyID:  familyID,
+		Claims:    claims,
+		ExpiresAt: pair.RefreshTokenExpiresAt,
+	}
+
+	switch s.config.RefreshTokenFormat {
+	case JWE:
+		refreshClaims := common.ClaimSet{
+			string(common.ExpirationTime): pair.RefreshTokenExpiresAt.Format(time.RFC3339),
+			FamilyClaim:                   familyID,
+			SecretClaim:                   refreshSecret,
+		}
+		tokenBuilder := jwt.NewJWEToken(s.config.RefreshEncryptionSuite, s.config.RefreshEncryptionKey)
+		if tokenBuilder == nil {
+			return nil, errors.New("failed to create refresh token")
+		}
+		pair.RefreshToken, err = tokenBuilder.
+			WithDecrypter(s.config.RefreshDecrypter).
+			WithoutAuditTokenID().
+			AddClaims(refreshClaims).
+			SerializeContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt refresh token: %w", err)
+		}
+	default:
+		pair.RefreshToken = refreshSecret
+	}
+	record.ID = hashOpaqueToken(refreshSecret)
+
+	if err := s.config.Store.Save(ctx, record); err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return pair, nil
+}
+
+// lookup resolves a refresh token to its record, checking expiry and family revocation.
+func (s *Service) lookup(ctx context.Context, refreshToken string) (RefreshRecord, error) {
+	id, err := s.refreshTokenID(ctx, refreshToken)
+	if err != nil {
+		return RefreshRecord{}, err
+	}
+
+	record, err := s.config.Store.Get(ctx, id)
+	if errors.Is(err, ErrRefreshRecordNotFound) {
+		return RefreshRecord{}, ErrRefreshTokenInvalid
+	} else if err != nil {
+		return RefreshRecord{}, fmt.Errorf("failed to load refresh token: %w", err)
+	}
+
+	revoked, err := s.config.Store.IsFamilyRevoked(ctx, record.FamilyID)
+	if err != nil {
+		return RefreshRecord{}, fmt.Errorf("failed to check refresh token family: %w", err)
+	}
+
+	if revoked {
+		return RefreshRecord{}, ErrRefreshTokenRevoked
+	}
+
+	if !time.Now().Before(record.ExpiresAt) {
+		return RefreshRecord{}, ErrRefreshTokenExpired
+	}
+
+	return record, nil
+}
+
+func (s *Service) refreshTokenID(ctx context.Context, refreshToken string) (string, error) {
+	if s.config.RefreshTokenFormat != JWE {
+		return hashOpaqueToken(refreshToken), nil
+	}
+
+	tokenBuilder, err := jwt.DecodeTokenContext(ctx, refreshToken, nil)
+	if err != nil {
+		return "", ErrRefreshTokenInvalid
+	}
+
+	// Only JWEs with the configured algorithms are accepted, so that an unsigned or HMAC'd JWS cannot stand in
+	// for a refresh token.
+	_, err = tokenBuilder.
+		RequireAlgorithmSuite(s.config.RefreshEncryptionSuite).
+		WithDecrypter(s.config.RefreshDecrypter).
+		WithoutAuditTokenID().
+		ValidateContext(ctx)
+	if err != nil {
+		return "", ErrRefreshTokenInvalid
+	}
+
+	secret, found := tokenBuilder.GetClaims().GetString(SecretClaim)
+	if !found || secret == "" {
+		return "", ErrRefreshTokenInvalid
+	}
+
+	return hashOpaqueToken(secret), nil
+}
+
+// checkSignerKey returns an error unless signer holds the type of key that algorithm signs with.
+func checkSignerKey(algorithm common.AlgorithmType, signer crypto.Signer) error {
+	switch publicKey := signer.Public().(type) {
+	case *rsa.PublicKey:
+		if algorithm == common.RS256 {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if algorithm == common.ES256 && publicKey.Curve == elliptic.P256() {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the signing key cannot be used for %s access tokens", algorithm)
+}
+
+func (s *Service) revokeFamily(ctx context.Context, familyID string) error {
+	// No refresh token in the family can outlive a token issued now.
+	expiresAt := time.Now().Add(s.config.RefreshTokenTTL)
+	if err := s.config.Store.RevokeFamily(ctx, familyID, expiresAt); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+// emitRefreshFailed records a refresh token that was not accepted as an audit.TokenValidationFailed event.
+func emitRefreshFailed(ctx context.Context, err error) {
+	audit.Emit(ctx, audit.Event{
+		Type:   audit.TokenValidationFailed,
+		Source: "session",
+		Reason: err.Error(),
+	})
+}
+
+// baseClaims copies claims, dropping those the Service sets on each access token.
+func baseClaims(claims common.ClaimSet) common.ClaimSet {
+	copied := common.NewClaimSet()
+	for k, v := range claims {
+		switch k {
+		case string(common.ExpirationTime), string(common.IssuedAt), string(common.JwtID):
+			continue
+		}
+		copied[k] = v
+	}
+
+	return copied
+}
+
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
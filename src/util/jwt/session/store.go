@@ -0,0 +1,146 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"sync"
+	"time"
+)
+
+// ErrRefreshRecordNotFound is returned by a RefreshStore when no record exists for an ID.
+var ErrRefreshRecordNotFound = errors.New("refresh token record not found")
+
+// RefreshRecord is the server-side state kept for an issued refresh token.
+type RefreshRecord struct {
+	// ID identifies the refresh token. It is a hash of the opaque refresh token, or of the secret in a JWE
+	// refresh token, so the token itself is never stored.
+	ID string
+	// FamilyID is shared by every refresh token descended from the same login.
+	FamilyID string
+	// Claims are the claims used to issue access tokens for this family.
+	Claims common.ClaimSet
+	// ExpiresAt is when the refresh token stops being accepted.
+	ExpiresAt time.Time
+	// Used is true once the refresh token has been exchanged.
+	Used bool
+}
+
+// RefreshStore persists refresh token records and refresh token families.
+//
+// Implementations backed by a shared store must perform MarkUsed atomically, otherwise two
+// concurrent refreshes with the same token can both succeed and reuse goes undetected.
+type RefreshStore interface {
+	// Save stores a newly issued refresh token record.
+	Save(ctx context.Context, record RefreshRecord) error
+
+	// Get returns the record for id, or ErrRefreshRecordNotFound.
+	Get(ctx context.Context, id string) (RefreshRecord, error)
+
+	// MarkUsed marks the record for id as used. It returns false if it was already used.
+	MarkUsed(ctx context.Context, id string) (bool, error)
+
+	// RevokeFamily revokes every refresh token in the family until expiresAt.
+	RevokeFamily(ctx context.Context, familyID string, expiresAt time.Time) error
+
+	// IsFamilyRevoked reports whether the family has been revoked.
+	IsFamilyRevoked(ctx context.Context, familyID string) (bool, error)
+}
+
+// MemoryRefreshStore is an in-process RefreshStore. Records and revoked families are evicted
+// once they have expired.
+type MemoryRefreshStore struct {
+	mu        sync.Mutex
+	records   map[string]RefreshRecord
+	families  map[string]time.Time
+	lastSweep time.Time
+}
+
+// memorySweepInterval bounds how often Save scans the store for expired entries.
+const memorySweepInterval = time.Minute
+
+// NewMemoryRefreshStore creates an empty MemoryRefreshStore.
+func NewMemoryRefreshStore() *MemoryRefreshStore {
+	return &MemoryRefreshStore{
+		records:  map[string]RefreshRecord{},
+		families: map[string]time.Time{},
+	}
+}
+
+func (s *MemoryRefreshStore) Save(_ context.Context, record RefreshRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= memorySweepInterval {
+		s.evictExpired(now)
+		s.lastSweep = now
+	}
+
+	s.records[record.ID] = record
+
+	return nil
+}
+
+func (s *MemoryRefreshStore) Get(_ context.Context, id string) (RefreshRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, found := s.records[id]
+	if !found {
+		return RefreshRecord{}, ErrRefreshRecordNotFound
+	}
+
+	return record, nil
+}
+
+func (s *MemoryRefreshStore) MarkUsed(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, found := s.records[id]
+	if !found {
+		return false, ErrRefreshRecordNotFound
+	}
+
+	if record.Used {
+		return false, nil
+	}
+
+	record.Used = true
+	s.records[id] = record
+
+	return true, nil
+}
+
+func (s *MemoryRefreshStore) RevokeFamily(_ context.Context, familyID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.families[familyID] = expiresAt
+
+	return nil
+}
+
+func (s *MemoryRefreshStore) IsFamilyRevoked(_ context.Context, familyID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, revoked := s.families[familyID]
+
+	return revoked, nil
+}
+
+func (s *MemoryRefreshStore) evictExpired(now time.Time) {
+	for id, record := range s.records {
+		if !now.Before(record.ExpiresAt) {
+			delete(s.records, id)
+		}
+	}
+
+	for familyID, expiresAt := range s.families {
+		if !now.Before(expiresAt) {
+			delete(s.families, familyID)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package util
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/sethvargo/go-envconfig"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigSource identifies the layer that provided a configuration field's value.
+type ConfigSource string
+
+const (
+	SourceUnset   ConfigSource = "unset"
+	SourceDefault ConfigSource = "default"
+	SourceSecret  ConfigSource = "secret"
+	SourceFile    ConfigSource = "file"
+	SourceEnv     ConfigSource = "env"
+	SourceFlag    ConfigSource = "flag"
+)
+
+// ConfigReport maps each configuration field, by its dotted Go field path (e.g. "Database.Host"),
+// to the layer its final value came from.
+type ConfigReport map[string]ConfigSource
+
+// String lists every field and its source, one per line, sorted by field path.
+func (r ConfigReport) String() string {
+	paths := make([]string, 0, len(r))
+	for path := range r {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&sb, "%s=%s\n", path, r[path])
+	}
+
+	return sb.String()
+}
+
+// LayeredOptions selects the layers applied by LoadLayeredConfiguration.
+type LayeredOptions struct {
+	// Secrets resolves `secret` tags (see LoadSecrets). The secret layer is skipped when it is nil.
+	Secrets SecretSource
+
+	// Files are the configuration files, lowest precedence first, in any format supported by
+	// LoadConfigurationFiles. The file layer is skipped when it is empty.
+	Files []string
+
+	// Env resolves `env` tags. Defaults to the process environment.
+	Env envconfig.Lookuper
+	// SkipEnv disables the environment variable layer.
+	SkipEnv bool
+
+	// Args are the command-line arguments, typically os.Args[1:]. The flag layer is skipped when Args is nil.
+	Args []string
+	// FlagSet receives a flag for each field tagged `flag:"name"`. Defaults to a new flag set that returns
+	// parse errors instead of exiting.
+	FlagSet *flag.FlagSet
+}
+
+// LoadLayeredConfiguration populates config from several layers, each overriding the ones before it:
+//
+//  1. `default:"value"` tags, applied to fields that are still zero.
+//  2. Secrets referenced by `secret` tags, from options.Secrets.
+//  3. The configuration files in options.Files, each overriding the ones before it.
+//  4. Environment variables named by `env` tags (an `env` variable that is set always wins over the file).
+//  5. Command-line flags named by `flag` tags, with an optional `usage` tag for help text.
+//
+// Parameters:
+//   - config: A pointer to the configuration struct to be populated.
+//   - options: The layers to apply.
+//
+// Returns:
+//   - A ConfigReport recording which layer provided each field.
+//   - An error if any layer fails to load or if the configuration fails validation.
+//
+// Validation (see ValidateStruct) runs once, after every layer has been applied. A layer that sets a field to
+// the value it already had does not change the field's reported source. Note that `env:",required"` must still
+// be satisfied by the environment itself, even if another layer provides the value; prefer `validate:"required"`.
+func LoadLayeredConfiguration[T Configuration](config T, options LayeredOptions) (ConfigReport, error) {
+	report, err := loadLayered(config, options)
+	if err != nil {
+		return report, err
+	}
+
+	if err := validateConfiguration(config); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// loadLayered applies the layers of LoadLayeredConfiguration without validating the result.
+func loadLayered(config Configuration, options LayeredOptions) (ConfigReport, error) {
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("config must be a pointer to a struct")
+	}
+
+	fields := configFields(v.Elem(), "")
+	report := ConfigReport{}
+	for _, f := range fields {
+		report[f.path] = SourceUnset
+	}
+
+	if err := applyDefaults(fields, report); err != nil {
+		return report, err
+	}
+
+	if options.Secrets != nil {
+		before := snapshotFields(fields)
+		if err := LoadSecrets(context.Background(), config, options.Secrets); err != nil {
+			return report, err
+		}
+		markChangedFields(fields, before, report, SourceSecret)
+	}
+
+	for _, path := range options.Files {
+		before := snapshotFields(fields)
+		if err := decodeConfigFile(path, config); err != nil {
+			return report, fmt.Errorf("%s: %w", path, err)
+		}
+		markChangedFields(fields, before, report, SourceFile)
+	}
+
+	if !options.SkipEnv {
+		lookuper := options.Env
+		if lookuper == nil {
+			lookuper = envconfig.OsLookuper()
+		}
+
+		before := snapshotFields(fields)
+		err := envconfig.ProcessWith(context.Background(), &envconfig.Config{
+			Target:           config,
+			Lookuper:         lookuper,
+			DefaultOverwrite: true,
+		})
+		if err != nil {
+			return report, fmt.Errorf("failed to process environment variables: %w", err)
+		}
+		markChangedFields(fields, before, report, SourceEnv)
+	}
+
+	if options.Args != nil {
+		if err := applyFlags(fields, options, report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// configField is a leaf field of a configuration struct.
+type configField struct {
+	path  string
+	field reflect.StructField
+	value reflect.Value
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// configFields returns the exported leaf fields of v, descending into nested structs.
+func configFields(v reflect.Value, prefix string) []configField {
+	var fields []configField
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		value := v.Field(i)
+		path := prefix + field.Name
+		if value.Kind() == reflect.Struct && !reflect.PointerTo(value.Type()).Implements(textUnmarshalerType) {
+			fields = append(fields, configFields(value, path+".")...)
+			continue
+		}
+
+		fields = append(fields, configField{path: path, field: field, value: value})
+	}
+
+	return fields
+}
+
+func snapshotFields(fields []configField) []interface{} {
+	snapshot := make([]interface{}, len(fields))
+	for i, f := range fields {
+		snapshot[i] = f.value.Interface()
+	}
+
+	return snapshot
+}
+
+func markChangedFields(fields []configField, before []interface{}, report ConfigReport, source ConfigSource) {
+	for i, f := range fields {
+		if !reflect.DeepEqual(before[i], f.value.Interface()) {
+			report[f.path] = source
+		}
+	}
+}
+
+func applyDefaults(fields []configField, report ConfigReport) error {
+	var errs []error
+	for _, f := range fields {
+		def, found := f.field.Tag.Lookup("default")
+		if !found || !f.value.IsZero() {
+			continue
+		}
+
+		if err := setFieldFromString(f.value, def); err != nil {
+			errs = append(errs, fmt.Errorf("invalid default for %s: %w", f.path, err))
+			continue
+		}
+		report[f.path] = SourceDefault
+	}
+
+	return errors.Join(errs...)
+}
+
+func applyFlags(fields []configField, options LayeredOptions, report ConfigReport) error {
+	flagSet := options.FlagSet
+	if flagSet == nil {
+		flagSet = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	}
+
+	for _, f := range fields {
+		name := f.field.Tag.Get("flag")
+		if name == "" {
+			continue
+		}
+
+		f := f
+		flagSet.Func(name, f.field.Tag.Get("usage"), func(s string) error {
+			if err := setFieldFromString(f.value, s); err != nil {
+				return err
+			}
+			report[f.path] = SourceFlag
+			return nil
+		})
+	}
+
+	if err := flagSet.Parse(options.Args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	return nil
+}
+
+// setFieldFromString parses s into v. Slices other than []byte are comma separated.
+func setFieldFromString(v reflect.Value, s string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+
+		parts := strings.Split(s, ",")
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setFieldFromString(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err := setFieldFromString(elem.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(elem)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Keys of the request-scoped fields attached by ContextWithRequestID, ContextWithSubject and ContextWithTraceID.
+const (
+	LogFieldRequestID = "request_id"
+	LogFieldSubject   = "subject"
+	LogFieldTraceID   = "trace_id"
+)
+
+type logFieldsKey struct{}
+
+// ContextWithLogFields returns a copy of ctx carrying fields, which are added to every line logged with ctx by
+// LogCtx and its variants. A field replaces any field already on ctx with the same key.
+//
+// Parameters:
+//   - ctx: The context to extend, typically a request context.
+//   - fields: The structured fields to attach, e.g. zap.String("order_id", id).
+//
+// Returns:
+//   - The new context.
+func ContextWithLogFields(ctx context.Context, fields ...zap.Field) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+
+	existing := LogFieldsFromContext(ctx)
+	merged := make([]zap.Field, 0, len(existing)+len(fields))
+	for _, field := range existing {
+		if !hasField(fields, field.Key) {
+			merged = append(merged, field)
+		}
+	}
+	merged = append(merged, fields...)
+
+	return context.WithValue(ctx, logFieldsKey{}, merged)
+}
+
+// LogFieldsFromContext returns the fields attached to ctx by ContextWithLogFields, or nil if there are none.
+func LogFieldsFromContext(ctx context.Context) []zap.Field {
+	if ctx == nil {
+		return nil
+	}
+
+	fields, _ := ctx.Value(logFieldsKey{}).([]zap.Field)
+	return fields
+}
+
+// ContextWithRequestID returns a copy of ctx whose log lines carry the request ID.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return ContextWithLogFields(ctx, zap.String(LogFieldRequestID, requestID))
+}
+
+// ContextWithSubject returns a copy of ctx whose log lines carry the authenticated subject, e.g. the "sub" claim.
+func ContextWithSubject(ctx context.Context, subject string) context.Context {
+	return ContextWithLogFields(ctx, zap.String(LogFieldSubject, subject))
+}
+
+// ContextWithTraceID returns a copy of ctx whose log lines carry the trace ID.
+func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
+	return ContextWithLogFields(ctx, zap.String(LogFieldTraceID, traceID))
+}
+
+// RequestIDFromContext returns the request ID attached by ContextWithRequestID, if any.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	return stringFieldFromContext(ctx, LogFieldRequestID)
+}
+
+// SubjectFromContext returns the subject attached by ContextWithSubject, if any.
+func SubjectFromContext(ctx context.Context) (string, bool) {
+	return stringFieldFromContext(ctx, LogFieldSubject)
+}
+
+// TraceIDFromContext returns the trace ID attached by ContextWithTraceID, if any.
+func TraceIDFromContext(ctx context.Context) (string, bool) {
+	return stringFieldFromContext(ctx, LogFieldTraceID)
+}
+
+// LoggerFromContext returns the global logger with the fields attached to ctx, for code that logs with zap directly.
+func LoggerFromContext(ctx context.Context) *zap.Logger {
+	return currentLogger().With(LogFieldsFromContext(ctx)...)
+}
+
+// LogCtx logs like Log, adding the fields attached to ctx.
+func LogCtx(ctx context.Context, lvl zapcore.Level, template string, args ...interface{}) {
+	logCtx(ctx, lvl, template, args)
+}
+
+// LogInfoCtx logs like LogInfo, adding the fields attached to ctx.
+func LogInfoCtx(ctx context.Context, template string, args ...interface{}) {
+	logCtx(ctx, zap.InfoLevel, template, args)
+}
+
+// LogWarnCtx logs like LogWarn, adding the fields attached to ctx.
+func LogWarnCtx(ctx context.Context, template string, args ...interface{}) {
+	logCtx(ctx, zap.WarnLevel, template, args)
+}
+
+// LogErrorCtx logs like LogError, adding the fields attached to ctx.
+func LogErrorCtx(ctx context.Context, template string, args ...interface{}) {
+	logCtx(ctx, zap.ErrorLevel, template, args)
+}
+
+// DebugCtx logs like Debug, adding the fields attached to ctx.
+func DebugCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	logw(ctx, zap.DebugLevel, msg, keysAndValues)
+}
+
+// InfoCtx logs like Info, adding the fields attached to ctx.
+func InfoCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	logw(ctx, zap.InfoLevel, msg, keysAndValues)
+}
+
+// WarnCtx logs like Warn, adding the fields attached to ctx.
+func WarnCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	logw(ctx, zap.WarnLevel, msg, keysAndValues)
+}
+
+// ErrorCtx logs like Error, adding the fields attached to ctx.
+func ErrorCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	logw(ctx, zap.ErrorLevel, msg, keysAndValues)
+}
+
+// logCtx logs like logf, adding the fields attached to ctx.
+func logCtx(ctx context.Context, lvl zapcore.Level, template string, args []interface{}) {
+	msg := fmt.Sprintf(template, args...)
+	logger := currentLogger()
+	writeDiscardedFatal(logger.Core(), lvl, msg)
+	logger.WithOptions(zap.AddCallerSkip(2)).Log(lvl, fmt.Sprintf("[ARMOR]: %s", msg), LogFieldsFromContext(ctx)...)
+}
+
+func hasField(fields []zap.Field, key string) bool {
+	for _, field := range fields {
+		if field.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func stringFieldFromContext(ctx context.Context, key string) (string, bool) {
+	for _, field := range LogFieldsFromContext(ctx) {
+		if field.Key == key && field.Type == zapcore.StringType {
+			return field.String, true
+		}
+	}
+	return "", false
+}
@@ -1,16 +1,24 @@
 package util
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"log"
+	"log/slog"
 	"os"
+	"syscall"
 )
 
+// Logger and SLogger discard everything until InitLogger or SetLogger is called, so that library code can log
+// safely from unit tests that do not initialize logging. LogFatal still writes its message to stderr before exiting.
 var (
-	SLogger *zap.SugaredLogger
-	Logger  *zap.Logger
+	SLogger = zap.NewNop().Sugar()
+	Logger  = zap.NewNop()
+
+	// LogLevel is the level of the global logger, which can be changed at runtime.
+	LogLevel = zap.NewAtomicLevelAt(zapcore.InfoLevel)
 )
 
 // InitLogger initializes a global logger based on the provided configuration.
@@ -18,112 +26,240 @@ var (
 // Parameters:
 //   - isRelease: If true, it sets up a production-ready JSON logger formatted for Cloud Run.
 //     If false, it uses a development-friendly console logger with color-coded levels.
+//     Release logs include the trace, span, HTTP request and source location fields read by Cloud Logging
+//     (see NewCloudLoggingCore and ContextWithTrace).
 //   - minimumLevel: Sets the minimum log level to be captured. Logs below this level will be ignored.
 //
 // Returns:
-//   - A function that can be called to flush any remaining log messages before the program terminates.
+//   - A function that can be called to flush any remaining log messages before the program terminates. It returns
+//     an error if the logger cannot be flushed (see SyncLogger).
 //
 // This function sets up the global `Logger` and `SLogger` variables, which can then be used throughout the application for logging.
+// It also makes the logger the log/slog default (see NewSlogHandler), so libraries logging with slog share its output.
 // The logger's behavior and output format are determined by the `isRelease` flag.
 // In release mode, logs are structured in JSON format, suitable for Cloud Run's logging infrastructure.
 // In development mode, logs are output to the console with color-coded levels for easier readability.
-func InitLogger(isRelease bool, minimumLevel zapcore.Level) func() {
-	var core zapcore.Core
+func InitLogger(isRelease bool, minimumLevel zapcore.Level) func() error {
+	return InitLoggerWithOptions(LoggerOptions{IsRelease: isRelease, MinimumLevel: minimumLevel})
+}
 
-	if isRelease {
-		var encoderConfig = zapcore.EncoderConfig{
-			TimeKey:        "time",
-			LevelKey:       "severity",
-			NameKey:        "logger",
-			CallerKey:      "caller",
-			MessageKey:     "message",
-			StacktraceKey:  "stacktrace",
-			LineEnding:     zapcore.DefaultLineEnding,
-			EncodeTime:     zapcore.ISO8601TimeEncoder,
-			EncodeDuration: zapcore.MillisDurationEncoder,
-			EncodeCaller:   zapcore.ShortCallerEncoder,
-		}
+// InitLoggerWithOptions initializes the global logger as InitLogger does, with additional sinks and sampling.
+//
+// Parameters:
+//   - options: The output format, level, sinks and sampling of the logger.
+//
+// Returns:
+//   - A function that can be called to flush any remaining log messages before the program terminates. It returns
+//     an error if the logger cannot be flushed (see SyncLogger).
+//
+// The logger's level is stored in `LogLevel`, which can be changed at runtime, e.g. with NewLevelHandler.
+func InitLoggerWithOptions(options LoggerOptions) func() error {
+	if options.Level == (zap.AtomicLevel{}) {
+		options.Level = zap.NewAtomicLevelAt(options.MinimumLevel)
+	}
 
-		// Map Zap levels to Cloud Run severity levels
-		encoderConfig.EncodeLevel = func(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
-			switch l {
-			case zapcore.DebugLevel:
-				enc.AppendString("DEBUG")
-			case zapcore.InfoLevel:
-				enc.AppendString("INFO")
-			case zapcore.WarnLevel:
-				enc.AppendString("WARNING")
-			case zapcore.ErrorLevel, zapcore.DPanicLevel, zapcore.PanicLevel, zapcore.FatalLevel:
-				enc.AppendString("ERROR")
-			default:
-				enc.AppendString("UNKNOWN")
-			}
-		}
+	logger := NewLoggerWithOptions(options)
+	LogLevel = options.Level
+	SetLogger(logger)
+	slog.SetDefault(slog.New(NewSlogHandler(logger)))
+
+	return func() error {
+		return SyncLogger(logger)
+	}
+}
+
+// SetLogger replaces the global `Logger` and `SLogger` used by the Log functions, e.g. with a logger configured by
+// the application or zaptest.NewLogger in tests. A nil logger discards everything.
+func SetLogger(logger *zap.Logger) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	Logger = logger
+	SLogger = logger.Sugar()
+}
+
+// SyncLogger flushes logger, ignoring the errors returned when stdout or stderr is a terminal or pipe, which
+// cannot be synced but have nothing buffered.
+//
+// Returns:
+//   - An error if any buffered log entries could not be written.
+func SyncLogger(logger *zap.Logger) error {
+	if err := logger.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTTY) {
+		return fmt.Errorf("failed to flush log buffer: %w", err)
+	}
+
+	return nil
+}
+
+// currentLogger returns the global logger, tolerating `Logger` having been set to nil.
+func currentLogger() *zap.Logger {
+	if logger := Logger; logger != nil {
+		return logger
+	}
+	return zap.NewNop()
+}
+
+// currentSugaredLogger returns the global sugared logger, tolerating `SLogger` having been set to nil.
+func currentSugaredLogger() *zap.SugaredLogger {
+	if logger := SLogger; logger != nil {
+		return logger
+	}
+	return currentLogger().Sugar()
+}
+
+// NewLogger creates a logger configured as InitLogger does, without replacing the global `Logger` and `SLogger`.
+//
+// Parameters:
+//   - isRelease: If true, the logger writes JSON formatted for Cloud Run, otherwise color-coded console output.
+//   - minimumLevel: Sets the minimum log level to be captured.
+//
+// Returns:
+//   - The new logger. Call Sync on it before the program terminates.
+func NewLogger(isRelease bool, minimumLevel zapcore.Level) *zap.Logger {
+	return NewLoggerWithOptions(LoggerOptions{IsRelease: isRelease, MinimumLevel: minimumLevel})
+}
+
+// NewLoggerWithOptions creates a logger configured as InitLoggerWithOptions does, without replacing the global
+// `Logger`, `SLogger` and `LogLevel`.
+//
+// Parameters:
+//   - options: The output format, level, sinks and sampling of the logger.
+//
+// Returns:
+//   - The new logger. Call Sync on it before the program terminates.
+func NewLoggerWithOptions(options LoggerOptions) *zap.Logger {
+	level := options.Level
+	if level == (zap.AtomicLevel{}) {
+		level = zap.NewAtomicLevelAt(options.MinimumLevel)
+	}
 
-		core = zapcore.NewCore(
-			zapcore.NewJSONEncoder(encoderConfig),
-			zapcore.AddSync(os.Stdout),
-			zap.NewAtomicLevelAt(minimumLevel),
+	var cores []zapcore.Core
+	if options.ErrorsToStderr {
+		cores = append(cores,
+			newConsoleCore(options.IsRelease, zapcore.AddSync(os.Stdout), zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+				return l < zapcore.ErrorLevel && level.Enabled(l)
+			})),
+			newConsoleCore(options.IsRelease, zapcore.AddSync(os.Stderr), zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+				return l >= zapcore.ErrorLevel && level.Enabled(l)
+			})),
 		)
 	} else {
-		encoderConfig := zap.NewDevelopmentEncoderConfig()
-		encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
-		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-
-		core = zapcore.NewCore(
-			zapcore.NewConsoleEncoder(encoderConfig),
-			zapcore.AddSync(os.Stdout),
-			zap.NewAtomicLevelAt(minimumLevel),
-		)
+		cores = append(cores, newConsoleCore(options.IsRelease, zapcore.AddSync(os.Stdout), level))
 	}
 
-	Logger = zap.New(core)
-	SLogger = Logger.Sugar()
+	if options.File != nil {
+		cores = append(cores, NewCloudLoggingCore(zapcore.AddSync(options.File.writer()), level))
+	}
 
-	return func() {
-		err := Logger.Sync()
-		if err != nil {
-			log.Fatalf("failed to flush log buffer: %v", err)
+	if !options.DisableRedaction {
+		redactor := NewRedactor(options.RedactFields...)
+		for i := range cores {
+			cores[i] = NewRedactingCore(cores[i], redactor)
 		}
 	}
+
+	core := zapcore.NewTee(cores...)
+	if options.Sampling != nil {
+		core = options.Sampling.wrap(core)
+	}
+
+	if options.IsRelease || options.File != nil {
+		return zap.New(core, zap.AddCaller())
+	}
+	return zap.New(core)
 }
 
-func Log(lvl zapcore.Level, template string, args ...interface{}) {
-	if SLogger == nil {
-		panic("[ARMOR] Before calling Log you must call InitArmor")
+// newConsoleCore creates the core writing to stdout or stderr: JSON formatted for Cloud Run in release mode,
+// otherwise color-coded console output.
+func newConsoleCore(isRelease bool, w zapcore.WriteSyncer, level zapcore.LevelEnabler) zapcore.Core {
+	if isRelease {
+		return NewCloudLoggingCore(w, level)
 	}
-	msg := fmt.Sprintf(template, args...)
-	SLogger.Logf(lvl, fmt.Sprintf("[ARMOR]: %s", msg))
+
+	encoderConfig := zap.NewDevelopmentEncoderConfig()
+	encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	// The caller is only recorded when a file sink is configured, and is written to the file.
+	encoderConfig.CallerKey = zapcore.OmitKey
+
+	return zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), w, level)
+}
+
+func Log(lvl zapcore.Level, template string, args ...interface{}) {
+	logf(lvl, template, args)
 }
 
 func LogInfo(template string, args ...interface{}) {
-	if SLogger == nil {
-		panic("[ARMOR] Before calling LogInfo you must call InitArmor")
-	}
-	msg := fmt.Sprintf(template, args...)
-	SLogger.Logf(zap.InfoLevel, fmt.Sprintf("[ARMOR]: %s", msg))
+	logf(zap.InfoLevel, template, args)
 }
 
 func LogWarn(template string, args ...interface{}) {
-	if SLogger == nil {
-		panic("[ARMOR] Before calling LogWarn you must call InitArmor")
-	}
-	msg := fmt.Sprintf(template, args...)
-	SLogger.Logf(zap.WarnLevel, fmt.Sprintf("[ARMOR]: %s", msg))
+	logf(zap.WarnLevel, template, args)
 }
 
 func LogError(template string, args ...interface{}) {
-	if SLogger == nil {
-		panic("[ARMOR] Before calling LogError you must call InitArmor")
-	}
-	msg := fmt.Sprintf(template, args...)
-	SLogger.Logf(zap.ErrorLevel, fmt.Sprintf("[ARMOR]: %s", msg))
+	logf(zap.ErrorLevel, template, args)
 }
 
 func LogFatal(template string, args ...interface{}) {
-	if SLogger == nil {
-		panic("[ARMOR] Before calling LogFetal you must call InitArmor")
-	}
+	logf(zap.FatalLevel, template, args)
+}
+
+// Debug logs msg with structured context at debug level, e.g. util.Debug("cache miss", "key", key).
+//
+// Parameters:
+//   - msg: The message, logged as is rather than used as a format string.
+//   - keysAndValues: Alternating keys and values, and/or zap.Field values, as with zap's SugaredLogger.Infow.
+func Debug(msg string, keysAndValues ...interface{}) {
+	logw(context.Background(), zap.DebugLevel, msg, keysAndValues)
+}
+
+// Info logs msg with structured context at info level, e.g. util.Info("user signed in", "user", id).
+// See Debug for the parameters.
+func Info(msg string, keysAndValues ...interface{}) {
+	logw(context.Background(), zap.InfoLevel, msg, keysAndValues)
+}
+
+// Warn logs msg with structured context at warning level. See Debug for the parameters.
+func Warn(msg string, keysAndValues ...interface{}) {
+	logw(context.Background(), zap.WarnLevel, msg, keysAndValues)
+}
+
+// Error logs msg with structured context at error level, e.g. util.Error("payment failed", zap.Error(err)).
+// See Debug for the parameters.
+func Error(msg string, keysAndValues ...interface{}) {
+	logw(context.Background(), zap.ErrorLevel, msg, keysAndValues)
+}
+
+// logf formats the message once and logs it without further formatting, so that % in arguments is kept.
+// It must be called directly by the exported Log functions for the caller to be reported correctly.
+func logf(lvl zapcore.Level, template string, args []interface{}) {
 	msg := fmt.Sprintf(template, args...)
-	SLogger.Logf(zap.FatalLevel, fmt.Sprintf("[ARMOR]: %s", msg))
+	logger := currentSugaredLogger()
+	writeDiscardedFatal(logger.Desugar().Core(), lvl, msg)
+	logger.WithOptions(zap.AddCallerSkip(2)).Log(lvl, fmt.Sprintf("[ARMOR]: %s", msg))
+}
+
+// writeDiscardedFatal writes msg to stderr if lvl is fatal and core discards it, as the Nop logger used before
+// InitLogger does. zap still exits the process in that case, which would otherwise happen without a word.
+func writeDiscardedFatal(core zapcore.Core, lvl zapcore.Level, msg string) {
+	if lvl == zapcore.FatalLevel && !core.Enabled(lvl) {
+		_, _ = fmt.Fprintf(os.Stderr, "[ARMOR]: %s\n", msg)
+	}
+}
+
+// logw logs msg with the fields attached to ctx, if any, followed by keysAndValues. It must be called directly
+// by the exported Log functions for the caller to be reported correctly.
+func logw(ctx context.Context, lvl zapcore.Level, msg string, keysAndValues []interface{}) {
+	var args []interface{}
+	if fields := LogFieldsFromContext(ctx); len(fields) > 0 {
+		args = make([]interface{}, 0, len(fields)+len(keysAndValues))
+		for _, field := range fields {
+			args = append(args, field)
+		}
+		keysAndValues = append(args, keysAndValues...)
+	}
+
+	currentSugaredLogger().WithOptions(zap.AddCallerSkip(2)).Logw(lvl, fmt.Sprintf("[ARMOR]: %s", msg), keysAndValues...)
 }
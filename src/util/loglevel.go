@@ -0,0 +1,156 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LevelHandler is an http.Handler that reports and changes a logger's level at runtime.
+//
+// GET responds with the current level. PUT or POST changes it, taking a JSON body such as
+// {"level": "debug", "duration": "5m"} or the same values as form or query parameters. When a duration is
+// given, the previous level is restored once it has elapsed.
+//
+// The handler has no authentication of its own; mount it behind helpers.BearerTokenMiddleware and
+// helpers.RequireScopes, or serve it on an internal port.
+type LevelHandler struct {
+	level zap.AtomicLevel
+
+	mu        sync.Mutex
+	timer     *time.Timer
+	revertTo  zapcore.Level
+	revertAt  time.Time
+	temporary bool
+}
+
+// NewLevelHandler creates a LevelHandler for level, e.g. util.NewLevelHandler(util.LogLevel).
+func NewLevelHandler(level zap.AtomicLevel) *LevelHandler {
+	return &LevelHandler{level: level}
+}
+
+type levelPayload struct {
+	Level    string     `json:"level"`
+	Duration string     `json:"duration,omitempty"`
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+func (h *LevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		if err := h.change(w, r); err != nil {
+			writeLevelResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		writeLevelResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	writeLevelResponse(w, http.StatusOK, h.state())
+}
+
+// SetLevel changes the level, restoring the previous one after duration unless it is zero. A later call replaces
+// any pending restore.
+func (h *LevelHandler) SetLevel(level zapcore.Level, duration time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+
+	// Restore the level in place before the first temporary change, not an earlier temporary level.
+	if !h.temporary {
+		h.revertTo = h.level.Level()
+	}
+	h.temporary = duration > 0
+	h.level.SetLevel(level)
+
+	if !h.temporary {
+		return
+	}
+
+	h.revertAt = time.Now().Add(duration)
+	var timer *time.Timer
+	timer = time.AfterFunc(duration, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if h.timer != timer {
+			return
+		}
+		h.level.SetLevel(h.revertTo)
+		h.timer, h.temporary = nil, false
+	})
+	h.timer = timer
+}
+
+func (h *LevelHandler) change(w http.ResponseWriter, r *http.Request) error {
+	var payload levelPayload
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&payload); err != nil {
+			return fmt.Errorf("invalid request body: %w", err)
+		}
+	} else {
+		payload.Level = r.FormValue("level")
+		payload.Duration = r.FormValue("duration")
+	}
+
+	if payload.Level == "" {
+		return errors.New("level is required")
+	}
+
+	level, err := zapcore.ParseLevel(payload.Level)
+	if err != nil {
+		return err
+	}
+
+	var duration time.Duration
+	if payload.Duration != "" {
+		duration, err = time.ParseDuration(payload.Duration)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("invalid duration %q", payload.Duration)
+		}
+	}
+
+	// Logged before the change, which may disable warnings.
+	LogWarn("Changing log level to %s for %s, requested by %s", level, durationOrPermanent(duration), r.RemoteAddr)
+	h.SetLevel(level, duration)
+
+	return nil
+}
+
+func (h *LevelHandler) state() levelPayload {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	payload := levelPayload{Level: h.level.Level().String()}
+	if h.temporary {
+		revertAt := h.revertAt
+		payload.RevertAt = &revertAt
+	}
+	return payload
+}
+
+func durationOrPermanent(duration time.Duration) string {
+	if duration == 0 {
+		return "an unlimited time"
+	}
+	return duration.String()
+}
+
+func writeLevelResponse(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
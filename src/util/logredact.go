@@ -0,0 +1,305 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"regexp"
+	"strings"
+)
+
+// DefaultRedactedFields are the field names whose values are always masked in logs. Names are compared
+// ignoring case, underscores and hyphens, so "api_key" also matches "apiKey" and "API-KEY".
+var DefaultRedactedFields = []string{
+	"password", "passwd", "secret", "client_secret", "token", "access_token", "refresh_token", "id_token",
+	"api_key", "authorization", "cookie", "set_cookie", "private_key",
+}
+
+var (
+	// jwtPattern matches compact JWS (three parts) and JWE (five parts) tokens, whose header always begins
+	// with the base64url encoding of `{"`.
+	jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*(?:\.[A-Za-z0-9_-]*){2,4}`)
+	// bearerPattern matches credentials after "Bearer", requiring a token-like length so that prose such as
+	// "bearer token" is left alone.
+	bearerPattern = regexp.MustCompile(`(?i)\b(bearer)\s+[A-Za-z0-9._~+/=-]{16,}`)
+	pemPattern    = regexp.MustCompile(`-----BEGIN ([A-Z0-9 ]+)-----[\s\S]*?-----END [A-Z0-9 ]+-----`)
+	// keyValuePattern matches JSON members such as `"password": "value"`, pairs such as `token=value`, formatted
+	// Go maps such as `map[password:value]`, and `password: value` at the start of a line or after a delimiter,
+	// so that the value can be masked when the key is sensitive. Values may start with an authentication scheme,
+	// as in `Authorization: Bearer value`. Prose such as "invalid token: expired" is left alone.
+	keyValuePattern = regexp.MustCompile(`("([A-Za-z0-9_-]+)"\s*:\s*|\b([A-Za-z0-9_-]+)[=:]|(?:^|[\n,;{(\[])[ \t]*([A-Za-z0-9_-]+):[ \t]+)` +
+		`("(?:[^"\\]|\\.)*"|(?i:bearer|basic)\s+[^\s,;&}\]"]+|[^\s,;&}\]"]+)`)
+)
+
+// Redactor masks credentials in log messages and fields: JWTs, bearer credentials, PEM blocks and the values
+// of sensitive field names.
+type Redactor struct {
+	fields map[string]struct{}
+}
+
+// NewRedactor creates a Redactor that masks DefaultRedactedFields and the given additional field names.
+func NewRedactor(fieldNames ...string) *Redactor {
+	r := &Redactor{fields: map[string]struct{}{}}
+	for _, name := range append(append([]string{}, DefaultRedactedFields...), fieldNames...) {
+		r.fields[normalizeFieldName(name)] = struct{}{}
+	}
+	return r
+}
+
+// IsSensitiveField reports whether the value of a field named name is masked.
+func (r *Redactor) IsSensitiveField(name string) bool {
+	_, ok := r.fields[normalizeFieldName(name)]
+	return ok
+}
+
+// RedactString returns s with credentials replaced by [REDACTED].
+func (r *Redactor) RedactString(s string) string {
+	if strings.Contains(s, "-----BEGIN ") {
+		s = pemPattern.ReplaceAllString(s, "-----BEGIN $1-----"+Redacted+"-----END $1-----")
+	}
+	if strings.Contains(s, "eyJ") {
+		s = jwtPattern.ReplaceAllString(s, Redacted)
+	}
+	s = bearerPattern.ReplaceAllString(s, "$1 "+Redacted)
+	if !strings.ContainsAny(s, ":=") {
+		return s
+	}
+
+	return keyValuePattern.ReplaceAllStringFunc(s, func(match string) string {
+		parts := keyValuePattern.FindStringSubmatch(match)
+		if !r.IsSensitiveField(parts[2] + parts[3] + parts[4]) {
+			return match
+		}
+		if strings.HasPrefix(parts[5], `"`) {
+			return parts[1] + `"` + Redacted + `"`
+		}
+		return parts[1] + Redacted
+	})
+}
+
+// RedactField returns field with credentials masked. Fields with sensitive names are replaced entirely; string,
+// byte string, error and fmt.Stringer values, and the URLs of HTTPRequest fields, are redacted with RedactString.
+// Objects, arrays and reflected values such as maps and structs are redacted as they are encoded, masking their
+// sensitive members and redacting their strings. Other values are returned as is.
+func (r *Redactor) RedactField(field zapcore.Field) zapcore.Field {
+	if r.IsSensitiveField(field.Key) {
+		return zap.String(field.Key, Redacted)
+	}
+
+	switch field.Type {
+	case zapcore.StringType:
+		field.String = r.RedactString(field.String)
+	case zapcore.ByteStringType:
+		return zap.String(field.Key, r.RedactString(string(field.Interface.([]byte))))
+	case zapcore.ErrorType:
+		if err, ok := field.Interface.(error); ok && err != nil {
+			return zap.String(field.Key, r.RedactString(err.Error()))
+		}
+	case zapcore.StringerType:
+		if stringer, ok := field.Interface.(fmt.Stringer); ok {
+			return zap.String(field.Key, r.RedactString(stringer.String()))
+		}
+	case zapcore.ObjectMarshalerType:
+		if request, ok := field.Interface.(HTTPRequest); ok {
+			request.URL = r.RedactString(request.URL)
+			request.Referer = r.RedactString(request.Referer)
+			return HTTPRequestField(request)
+		}
+		if marshaler, ok := field.Interface.(zapcore.ObjectMarshaler); ok {
+			field.Interface = redactingObject{marshaler: marshaler, redactor: r}
+		}
+	case zapcore.InlineMarshalerType:
+		if marshaler, ok := field.Interface.(zapcore.ObjectMarshaler); ok {
+			field.Interface = redactingObject{marshaler: marshaler, redactor: r}
+		}
+	case zapcore.ArrayMarshalerType:
+		if marshaler, ok := field.Interface.(zapcore.ArrayMarshaler); ok {
+			field.Interface = redactingArray{marshaler: marshaler, redactor: r}
+		}
+	case zapcore.ReflectType:
+		field.Interface = r.redactReflected(field.Interface)
+	}
+
+	return field
+}
+
+// redactReflected returns a copy of value, which is encoded with encoding/json, with its sensitive members masked
+// and its strings redacted. Values that cannot be encoded are replaced entirely.
+func (r *Redactor) redactReflected(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return Redacted
+	}
+
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return Redacted
+	}
+
+	return r.redactDecoded(decoded)
+}
+
+func (r *Redactor) redactDecoded(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.RedactString(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = r.redactDecoded(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			if r.IsSensitiveField(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = r.redactDecoded(v[key])
+			}
+		}
+	}
+	return value
+}
+
+// redactingObject redacts an object as it is encoded.
+type redactingObject struct {
+	marshaler zapcore.ObjectMarshaler
+	redactor  *Redactor
+}
+
+func (o redactingObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	return o.marshaler.MarshalLogObject(redactingObjectEncoder{ObjectEncoder: enc, redactor: o.redactor})
+}
+
+// redactingArray redacts an array as it is encoded.
+type redactingArray struct {
+	marshaler zapcore.ArrayMarshaler
+	redactor  *Redactor
+}
+
+func (a redactingArray) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	return a.marshaler.MarshalLogArray(redactingArrayEncoder{ArrayEncoder: enc, redactor: a.redactor})
+}
+
+// redactingObjectEncoder masks the members of an object with sensitive keys and redacts its strings and
+// nested values.
+type redactingObjectEncoder struct {
+	zapcore.ObjectEncoder
+	redactor *Redactor
+}
+
+func (e redactingObjectEncoder) AddArray(key string, marshaler zapcore.ArrayMarshaler) error {
+	if e.redactor.IsSensitiveField(key) {
+		e.ObjectEncoder.AddString(key, Redacted)
+		return nil
+	}
+	return e.ObjectEncoder.AddArray(key, redactingArray{marshaler: marshaler, redactor: e.redactor})
+}
+
+func (e redactingObjectEncoder) AddObject(key string, marshaler zapcore.ObjectMarshaler) error {
+	if e.redactor.IsSensitiveField(key) {
+		e.ObjectEncoder.AddString(key, Redacted)
+		return nil
+	}
+	return e.ObjectEncoder.AddObject(key, redactingObject{marshaler: marshaler, redactor: e.redactor})
+}
+
+func (e redactingObjectEncoder) AddBinary(key string, value []byte) {
+	if e.redactor.IsSensitiveField(key) {
+		e.ObjectEncoder.AddString(key, Redacted)
+		return
+	}
+	e.ObjectEncoder.AddBinary(key, value)
+}
+
+func (e redactingObjectEncoder) AddByteString(key string, value []byte) {
+	e.AddString(key, string(value))
+}
+
+func (e redactingObjectEncoder) AddString(key, value string) {
+	if e.redactor.IsSensitiveField(key) {
+		e.ObjectEncoder.AddString(key, Redacted)
+		return
+	}
+	e.ObjectEncoder.AddString(key, e.redactor.RedactString(value))
+}
+
+func (e redactingObjectEncoder) AddReflected(key string, value interface{}) error {
+	if e.redactor.IsSensitiveField(key) {
+		e.ObjectEncoder.AddString(key, Redacted)
+		return nil
+	}
+	return e.ObjectEncoder.AddReflected(key, e.redactor.redactReflected(value))
+}
+
+// redactingArrayEncoder redacts the strings and nested values of an array.
+type redactingArrayEncoder struct {
+	zapcore.ArrayEncoder
+	redactor *Redactor
+}
+
+func (e redactingArrayEncoder) AppendArray(marshaler zapcore.ArrayMarshaler) error {
+	return e.ArrayEncoder.AppendArray(redactingArray{marshaler: marshaler, redactor: e.redactor})
+}
+
+func (e redactingArrayEncoder) AppendObject(marshaler zapcore.ObjectMarshaler) error {
+	return e.ArrayEncoder.AppendObject(redactingObject{marshaler: marshaler, redactor: e.redactor})
+}
+
+func (e redactingArrayEncoder) AppendByteString(value []byte) {
+	e.AppendString(string(value))
+}
+
+func (e redactingArrayEncoder) AppendString(value string) {
+	e.ArrayEncoder.AppendString(e.redactor.RedactString(value))
+}
+
+func (e redactingArrayEncoder) AppendReflected(value interface{}) error {
+	return e.ArrayEncoder.AppendReflected(e.redactor.redactReflected(value))
+}
+
+func normalizeFieldName(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// NewRedactingCore wraps core so that messages and fields are redacted by redactor before they are written.
+// Wrap each core before combining them with zapcore.NewTee, as a tee writes entries to every core it holds
+// regardless of their levels.
+func NewRedactingCore(core zapcore.Core, redactor *Redactor) zapcore.Core {
+	return redactingCore{Core: core, redactor: redactor}
+}
+
+type redactingCore struct {
+	zapcore.Core
+	redactor *Redactor
+}
+
+func (c redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactingCore{Core: c.Core.With(c.redactFields(fields)), redactor: c.redactor}
+}
+
+func (c redactingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c redactingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.redactor.RedactString(ent.Message)
+	return c.Core.Write(ent, c.redactFields(fields))
+}
+
+func (c redactingCore) redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		redacted[i] = c.redactor.RedactField(field)
+	}
+	return redacted
+}
@@ -0,0 +1,144 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Redacted replaces the value of secrets in redacted output.
+const Redacted = "[REDACTED]"
+
+// ErrSecretNotSerializable is returned when a Secret is marshalled to JSON.
+var ErrSecretNotSerializable = errors.New("secret values cannot be serialized")
+
+// Secret is a string that is never revealed by formatting, logging or JSON encoding. It prints as
+// [REDACTED] with any fmt verb (and therefore through zap and the Log functions), and refuses to be
+// marshalled to JSON, so SerializeJson fails rather than leaking it. Use Reveal to read the value.
+//
+// Secret fields are loaded like any other string field from files, environment variables and secret sources.
+type Secret string
+
+// Reveal returns the secret value.
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	return Redacted
+}
+
+func (s Secret) GoString() string {
+	return Redacted
+}
+
+// Format implements fmt.Formatter so that verbs such as %q and %x do not bypass String.
+func (s Secret) Format(f fmt.State, _ rune) {
+	_, _ = f.Write([]byte(Redacted))
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return nil, ErrSecretNotSerializable
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return nil, ErrSecretNotSerializable
+}
+
+// UnmarshalText allows a Secret to be decoded from configuration files and flags even though it cannot be encoded.
+func (s *Secret) UnmarshalText(text []byte) error {
+	*s = Secret(text)
+	return nil
+}
+
+var secretType = reflect.TypeOf(Secret(""))
+
+// RedactConfiguration renders config as indented JSON with sensitive values masked, so that the effective
+// configuration can be logged safely.
+//
+// Parameters:
+//   - config: The configuration struct, or a pointer to it.
+//
+// Returns:
+//   - The JSON representation of config, using `json` tag names where present. Fields of type Secret and
+//     fields with a `secret` tag (either `secret:"true"` or a secret reference resolved by LoadSecrets) are
+//     replaced with [REDACTED] unless they are empty.
+func RedactConfiguration(config interface{}) string {
+	bytes, err := json.MarshalIndent(redactValue(reflect.ValueOf(config), false), "", "  ")
+	if err != nil {
+		return fmt.Sprintf("<unable to render configuration: %v>", err)
+	}
+
+	return string(bytes)
+}
+
+func redactValue(v reflect.Value, sensitive bool) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem(), sensitive)
+	}
+
+	if sensitive || v.Type() == secretType {
+		if v.IsZero() {
+			return ""
+		}
+		return Redacted
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type().Implements(jsonMarshalerType) || reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+			return v.Interface()
+		}
+
+		out := map[string]interface{}{}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			secret := field.Tag.Get("secret")
+			out[name] = redactValue(v.Field(i), secret != "" && secret != "false")
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i), false)
+		}
+		return out
+	case reflect.Map:
+		out := map[string]interface{}{}
+		iter := v.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(iter.Key().Interface())] = redactValue(iter.Value(), false)
+		}
+		return out
+	}
+
+	return v.Interface()
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
@@ -0,0 +1,311 @@
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConfigLoaderFunc loads a new, fully populated configuration, e.g. by reading files, environment
+// variables or secrets into a freshly allocated struct.
+type ConfigLoaderFunc[T Configuration] func(ctx context.Context) (T, error)
+
+// FileConfigLoader returns a ConfigLoaderFunc that loads the given files into a new *T, as with
+// LoadConfigurationFiles.
+func FileConfigLoader[T any, PT interface {
+	*T
+	Configuration
+}](configFilePaths ...string) ConfigLoaderFunc[PT] {
+	return func(_ context.Context) (PT, error) {
+		config := PT(new(T))
+		for _, configFilePath := range configFilePaths {
+			if err := decodeConfigFile(configFilePath, config); err != nil {
+				return nil, fmt.Errorf("%s: %w", configFilePath, err)
+			}
+		}
+
+		return config, nil
+	}
+}
+
+// LayeredConfigLoader returns a ConfigLoaderFunc that loads a new *T, as with LoadLayeredConfiguration.
+// A fresh flag set is used on every load, so options.FlagSet is ignored.
+func LayeredConfigLoader[T any, PT interface {
+	*T
+	Configuration
+}](options LayeredOptions) ConfigLoaderFunc[PT] {
+	options.FlagSet = nil
+
+	return func(_ context.Context) (PT, error) {
+		config := PT(new(T))
+		if _, err := loadLayered(config, options); err != nil {
+			return nil, err
+		}
+
+		return config, nil
+	}
+}
+
+// WatchOptions configures a ConfigWatcher.
+type WatchOptions struct {
+	// Interval is how often the configuration is checked. Defaults to 30 seconds.
+	Interval time.Duration
+
+	// Files, when set, limits reloads to intervals in which the content of at least one of these files
+	// has changed. When empty, the configuration is reloaded on every interval, which suits environment
+	// variable and secret sources.
+	Files []string
+
+	// OnError is called when a reload fails. Defaults to logging the error. The current configuration
+	// is kept whenever a reload fails.
+	OnError func(err error)
+}
+
+// ConfigWatcher holds the current configuration and periodically reloads it, swapping in the new
+// configuration only when it loads and validates successfully.
+type ConfigWatcher[T Configuration] struct {
+	load    ConfigLoaderFunc[T]
+	options WatchOptions
+
+	current  atomic.Value
+	reloadMu sync.Mutex
+
+	mu          sync.Mutex
+	subscribers map[int]func(previous T, current T)
+	nextID      int
+
+	fileHash []byte
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// WatchConfiguration loads the configuration and starts watching it for changes until ctx is done or
+// Close is called.
+//
+// Parameters:
+//   - ctx: Controls the lifetime of the watcher and is passed to load.
+//   - load: Loads a new configuration, e.g. FileConfigLoader[AppConfig]("config.yaml").
+//   - options: How often, and on which file changes, to reload.
+//
+// Returns:
+//   - A ConfigWatcher whose Current method returns the latest valid configuration.
+//   - An error if the initial configuration cannot be loaded or fails validation.
+func WatchConfiguration[T Configuration](ctx context.Context, load ConfigLoaderFunc[T], options WatchOptions) (*ConfigWatcher[T], error) {
+	if options.Interval <= 0 {
+		options.Interval = 30 * time.Second
+	}
+
+	if options.OnError == nil {
+		options.OnError = func(err error) {
+			LogError("failed to reload configuration: %v", err)
+		}
+	}
+
+	w := &ConfigWatcher[T]{
+		load:        load,
+		options:     options,
+		subscribers: map[int]func(previous T, current T){},
+		done:        make(chan struct{}),
+	}
+
+	w.fileHash, _ = hashFiles(options.Files)
+	config, err := w.loadAndValidate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w.current.Store(config)
+
+	ctx, w.cancel = context.WithCancel(ctx)
+	go w.run(ctx)
+
+	return w, nil
+}
+
+// Current returns the latest valid configuration. Callers should not modify it.
+func (w *ConfigWatcher[T]) Current() T {
+	return w.current.Load().(T)
+}
+
+// Subscribe registers fn to be called with the previous and new configuration after every change.
+// Callbacks run sequentially on the watcher's goroutine, or on the goroutine calling Reload.
+//
+// Returns:
+//   - A function that removes the subscription.
+func (w *ConfigWatcher[T]) Subscribe(fn func(previous T, current T)) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := w.nextID
+	w.nextID++
+	w.subscribers[id] = fn
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subscribers, id)
+	}
+}
+
+// Changes returns a channel that receives each new configuration. Slow readers only see the latest
+// configuration; intermediate ones are dropped.
+//
+// Returns:
+//   - The channel.
+//   - A function that stops the deliveries and closes the channel. Call it once the channel is no longer read,
+//     otherwise the subscription lasts as long as the watcher.
+func (w *ConfigWatcher[T]) Changes() (<-chan T, func()) {
+	ch := make(chan T, 1)
+
+	var mu sync.Mutex
+	closed := false
+	unsubscribe := w.Subscribe(func(_ T, current T) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+
+		for {
+			select {
+			case ch <- current:
+				return
+			default:
+			}
+
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	})
+
+	return ch, func() {
+		unsubscribe()
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !closed {
+			closed = true
+			close(ch)
+		}
+	}
+}
+
+// Reload loads the configuration immediately, regardless of file changes.
+//
+// Returns:
+//   - An error if the configuration cannot be loaded or fails validation, in which case the current
+//     configuration is kept.
+func (w *ConfigWatcher[T]) Reload(ctx context.Context) error {
+	// Loading happens under reloadMu too, so a slow reload cannot finish after, and overwrite, a newer one.
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	config, err := w.loadAndValidate(ctx)
+	if err != nil {
+		return err
+	}
+
+	previous := w.Current()
+	if reflect.DeepEqual(previous, config) {
+		return nil
+	}
+	w.current.Store(config)
+
+	w.mu.Lock()
+	subscribers := make([]func(previous T, current T), 0, len(w.subscribers))
+	for _, fn := range w.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	w.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(previous, config)
+	}
+
+	return nil
+}
+
+// Close stops watching. The last configuration remains available from Current.
+func (w *ConfigWatcher[T]) Close() {
+	w.cancel()
+	<-w.done
+}
+
+func (w *ConfigWatcher[T]) loadAndValidate(ctx context.Context) (T, error) {
+	config, err := w.load(ctx)
+	if err != nil {
+		return config, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if err := validateConfiguration(config); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+func (w *ConfigWatcher[T]) run(ctx context.Context) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var fileHash []byte
+		if len(w.options.Files) > 0 {
+			var err error
+			fileHash, err = hashFiles(w.options.Files)
+			if err != nil {
+				w.options.OnError(err)
+				continue
+			}
+
+			if string(fileHash) == string(w.fileHash) {
+				continue
+			}
+		}
+
+		if err := w.Reload(ctx); err != nil {
+			// The stored hash is left unchanged so that the reload is retried on the next tick, e.g. once a
+			// half-written file is complete.
+			w.options.OnError(err)
+			continue
+		}
+
+		if fileHash != nil {
+			w.fileHash = fileHash
+		}
+	}
+}
+
+// hashFiles returns a digest of the content of every file, so that changes made by rewriting or
+// atomically replacing a file (as with Kubernetes ConfigMap volumes) are both detected.
+func hashFiles(paths []string) ([]byte, error) {
+	h := sha256.New()
+	var errs []error
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read config file: %w", err))
+			continue
+		}
+
+		sum := sha256.Sum256(data)
+		h.Write(sum[:])
+	}
+
+	return h.Sum(nil), errors.Join(errs...)
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SecretSource resolves secret references, such as Secret Manager version names, to their values.
+type SecretSource interface {
+	AccessSecret(ctx context.Context, name string) ([]byte, error)
+}
+
+// LoadSecrets populates configuration fields tagged with a secret reference from the given source.
+//
+// Parameters:
+//   - ctx: The context passed to the secret source.
+//   - config: A pointer to the configuration struct to be populated.
+//   - source: The SecretSource used to resolve each reference.
+//
+// Returns:
+//   - An error listing every secret that could not be resolved, or if the configuration is not a pointer to a struct.
+//
+// Fields are tagged with the full name of the secret, e.g.
+//
+//	DbPassword string `json:"db_password" secret:"projects/my-project/secrets/db-password/versions/latest"`
+//
+// Only string and []byte fields (including those of nested structs) are supported. A tag value without a "/"
+// (such as `secret:"true"`) marks a field as sensitive but is not resolved. Validation is not performed here,
+// since secrets are usually loaded alongside another source; call Validate once every source has been applied.
+func LoadSecrets[T Configuration](ctx context.Context, config T, source SecretSource) error {
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("config must be a pointer to a struct")
+	}
+
+	var errs []error
+	loadSecretFields(ctx, v.Elem(), source, &errs)
+
+	return errors.Join(errs...)
+}
+
+func loadSecretFields(ctx context.Context, v reflect.Value, source SecretSource, errs *[]error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if value.Kind() == reflect.Struct {
+			loadSecretFields(ctx, value, source, errs)
+			continue
+		}
+
+		name := field.Tag.Get("secret")
+		if !strings.Contains(name, "/") {
+			continue
+		}
+
+		secret, err := source.AccessSecret(ctx, name)
+		if err != nil {
+			*errs = append(*errs, fmt.Errorf("failed to access secret for %s: %w", field.Name, err))
+			continue
+		}
+
+		switch {
+		case value.Kind() == reflect.String:
+			value.SetString(string(secret))
+		case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8:
+			value.SetBytes(secret)
+		default:
+			*errs = append(*errs, fmt.Errorf("secret field %s must be a string or []byte", field.Name))
+		}
+	}
+}
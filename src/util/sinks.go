@@ -0,0 +1,97 @@
+package util
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"time"
+)
+
+// LoggerOptions configures the logger created by InitLoggerWithOptions and NewLoggerWithOptions.
+type LoggerOptions struct {
+	// IsRelease selects JSON output formatted for Cloud Run rather than color-coded console output.
+	IsRelease bool
+
+	// MinimumLevel is the initial minimum level, used when Level is not set.
+	MinimumLevel zapcore.Level
+
+	// Level, when set, is the level shared with the caller, who can change it at runtime.
+	Level zap.AtomicLevel
+
+	// ErrorsToStderr writes entries at error level and above to stderr rather than stdout.
+	ErrorsToStderr bool
+
+	// File, when set, additionally writes every entry as JSON to a rotated file.
+	File *FileSinkOptions
+
+	// RedactFields are field names, in addition to DefaultRedactedFields, whose values are masked. JWTs, bearer
+	// credentials and PEM blocks are masked too (see Redactor).
+	RedactFields []string
+
+	// DisableRedaction writes messages and fields without masking credentials.
+	DisableRedaction bool
+
+	// Sampling, when set, limits how many entries with the same level and message are written per tick,
+	// which bounds the cost of logging on hot paths.
+	Sampling *SamplingOptions
+}
+
+// FileSinkOptions configures a log file that is rotated when it reaches MaxSizeMB. Rotated files are renamed
+// with a timestamp and kept in the same directory.
+type FileSinkOptions struct {
+	// Path of the log file. Its directory is created if needed.
+	Path string
+
+	// MaxSizeMB is the size at which the file is rotated. Defaults to 100.
+	MaxSizeMB int
+
+	// MaxBackups is the number of rotated files to keep. Defaults to keeping all of them.
+	MaxBackups int
+
+	// MaxAge is how long rotated files are kept. Defaults to keeping them regardless of age.
+	MaxAge time.Duration
+
+	// Compress gzips rotated files.
+	Compress bool
+}
+
+func (o *FileSinkOptions) writer() *lumberjack.Logger {
+	return &lumberjack.Logger{
+		Filename:   o.Path,
+		MaxSize:    o.MaxSizeMB,
+		MaxBackups: o.MaxBackups,
+		MaxAge:     int((o.MaxAge + 24*time.Hour - 1) / (24 * time.Hour)),
+		Compress:   o.Compress,
+	}
+}
+
+// SamplingOptions writes the first First entries with the same level and message in each Tick, then every
+// Thereafter-th one. Sampled out entries are dropped.
+type SamplingOptions struct {
+	// Tick is the sampling interval. Defaults to one second.
+	Tick time.Duration
+
+	// First is the number of identical entries written in full each tick. Defaults to 100.
+	First int
+
+	// Thereafter is the sampling rate once First is reached, e.g. 100 writes every hundredth entry. Defaults
+	// to 100; set to -1 to drop every entry past First.
+	Thereafter int
+}
+
+func (o *SamplingOptions) wrap(core zapcore.Core) zapcore.Core {
+	tick, first, thereafter := o.Tick, o.First, o.Thereafter
+	if tick <= 0 {
+		tick = time.Second
+	}
+	if first <= 0 {
+		first = 100
+	}
+	if thereafter == 0 {
+		thereafter = 100
+	} else if thereafter < 0 {
+		thereafter = 0
+	}
+
+	return zapcore.NewSamplerWithOptions(core, tick, first, thereafter)
+}
@@ -0,0 +1,157 @@
+package util
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"log/slog"
+	"runtime"
+)
+
+// SlogHandler is a slog.Handler that writes records to a zap logger, so that libraries using log/slog share
+// armor's output format, level and sinks. Fields attached to the record's context with ContextWithLogFields are
+// added to every record.
+type SlogHandler struct {
+	logger *zap.Logger
+	// ops holds the groups and attributes added by WithGroup and WithAttrs, in order.
+	ops []slogOp
+}
+
+type slogOp struct {
+	group string
+	attrs []slog.Attr
+}
+
+// NewSlogHandler creates a slog.Handler writing to logger, e.g. slog.New(util.NewSlogHandler(util.Logger)).
+// InitLogger installs one as the slog default.
+func NewSlogHandler(logger *zap.Logger) *SlogHandler {
+	return &SlogHandler{logger: logger}
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Core().Enabled(zapLevel(level))
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	ce := h.logger.Check(zapLevel(record.Level), record.Message)
+	if ce == nil {
+		return nil
+	}
+
+	if !record.Time.IsZero() {
+		ce.Time = record.Time
+	}
+	if ce.Caller.Defined && record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		ce.Caller = zapcore.NewEntryCaller(frame.PC, frame.File, frame.Line, true)
+		ce.Caller.Function = frame.Function
+	}
+
+	fields := append([]zap.Field{}, LogFieldsFromContext(ctx)...)
+	for _, op := range h.ops {
+		if op.group != "" {
+			fields = append(fields, zap.Namespace(op.group))
+			continue
+		}
+		fields = appendSlogAttrs(fields, op.attrs)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		fields = appendSlogAttrs(fields, []slog.Attr{attr})
+		return true
+	})
+
+	ce.Write(fields...)
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(slogOp{attrs: attrs})
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(slogOp{group: name})
+}
+
+func (h *SlogHandler) with(op slogOp) *SlogHandler {
+	ops := make([]slogOp, 0, len(h.ops)+1)
+	ops = append(ops, h.ops...)
+	return &SlogHandler{logger: h.logger, ops: append(ops, op)}
+}
+
+// zapLevel maps slog levels, which may fall between the named levels, to the nearest zap level below them.
+func zapLevel(level slog.Level) zapcore.Level {
+	switch {
+	case level < slog.LevelInfo:
+		return zapcore.DebugLevel
+	case level < slog.LevelWarn:
+		return zapcore.InfoLevel
+	case level < slog.LevelError:
+		return zapcore.WarnLevel
+	default:
+		return zapcore.ErrorLevel
+	}
+}
+
+func appendSlogAttrs(fields []zap.Field, attrs []slog.Attr) []zap.Field {
+	for _, attr := range attrs {
+		attr.Value = attr.Value.Resolve()
+		if attr.Equal(slog.Attr{}) {
+			continue
+		}
+
+		if attr.Value.Kind() == slog.KindGroup {
+			group := attr.Value.Group()
+			if len(group) == 0 {
+				continue
+			}
+			if attr.Key == "" {
+				fields = appendSlogAttrs(fields, group)
+				continue
+			}
+			fields = append(fields, zap.Object(attr.Key, slogGroup(group)))
+			continue
+		}
+
+		fields = append(fields, slogField(attr))
+	}
+	return fields
+}
+
+func slogField(attr slog.Attr) zap.Field {
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return zap.String(attr.Key, attr.Value.String())
+	case slog.KindInt64:
+		return zap.Int64(attr.Key, attr.Value.Int64())
+	case slog.KindUint64:
+		return zap.Uint64(attr.Key, attr.Value.Uint64())
+	case slog.KindFloat64:
+		return zap.Float64(attr.Key, attr.Value.Float64())
+	case slog.KindBool:
+		return zap.Bool(attr.Key, attr.Value.Bool())
+	case slog.KindDuration:
+		return zap.Duration(attr.Key, attr.Value.Duration())
+	case slog.KindTime:
+		return zap.Time(attr.Key, attr.Value.Time())
+	}
+
+	if err, ok := attr.Value.Any().(error); ok {
+		return zap.NamedError(attr.Key, err)
+	}
+	return zap.Any(attr.Key, attr.Value.Any())
+}
+
+type slogGroup []slog.Attr
+
+func (g slogGroup) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, field := range appendSlogAttrs(nil, g) {
+		field.AddTo(enc)
+	}
+	return nil
+}
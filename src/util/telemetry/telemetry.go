@@ -0,0 +1,190 @@
+// Package telemetry records OpenTelemetry spans and metrics for armor's token and password operations, so that
+// the time spent on cryptography can be seen in traces and latency percentiles.
+//
+// Telemetry is optional: it uses the global tracer and meter providers, which discard everything until the
+// application installs an OpenTelemetry SDK with otel.SetTracerProvider and otel.SetMeterProvider.
+package telemetry
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"sync/atomic"
+	"time"
+)
+
+// InstrumentationName is the name of the tracer and meter that record armor's telemetry.
+const InstrumentationName = "github.com/bmwadforth-com/armor-go"
+
+// Operation identifies an instrumented operation. It is the name of its spans and the value of the
+// OperationKey attribute.
+type Operation string
+
+const (
+	TokenSerialize  Operation = "jwt.serialize"
+	TokenDecode     Operation = "jwt.decode"
+	TokenValidate   Operation = "jwt.validate"
+	JWEEncrypt      Operation = "jwe.encrypt"
+	JWEDecrypt      Operation = "jwe.decrypt"
+	PasswordHash    Operation = "bcrypt.hash"
+	PasswordCompare Operation = "bcrypt.compare"
+)
+
+// Attribute keys recorded on spans and metrics.
+const (
+	OperationKey = attribute.Key("armor.operation")
+	AlgorithmKey = attribute.Key("armor.algorithm")
+	// ReasonKey is only recorded on failures, with one of the Reason constants.
+	ReasonKey = attribute.Key("armor.failure.reason")
+)
+
+// Failure reasons. They are kept few so that the failure counter has a bounded number of series; the error
+// itself is recorded on the span.
+const (
+	ReasonError     = "error"
+	ReasonMalformed = "malformed"
+	ReasonInvalid   = "invalid"
+	ReasonExpired   = "expired"
+	ReasonRevoked   = "revoked"
+	ReasonReplayed  = "replayed"
+	ReasonMismatch  = "mismatch"
+)
+
+// UnknownAlgorithm is recorded as the AlgorithmKey attribute instead of an algorithm armor does not support. The
+// algorithm of a decoded token comes from its unauthenticated header, so passing it through would let anyone
+// create an unbounded number of metric series.
+const UnknownAlgorithm = "unknown"
+
+// Metric names.
+const (
+	DurationMetric = "armor.operation.duration"
+	FailureMetric  = "armor.operation.failures"
+)
+
+// durationBuckets span HMAC signatures, which take microseconds, to bcrypt, which takes hundreds of milliseconds.
+var durationBuckets = []float64{
+	0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5,
+}
+
+type instruments struct {
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	failures metric.Int64Counter
+}
+
+var current atomic.Pointer[instruments]
+
+func init() {
+	SetProviders(nil, nil)
+}
+
+// SetProviders makes telemetry be recorded with the given providers instead of the global ones, e.g. to
+// instrument armor separately from the rest of the application, or in tests. A nil provider uses the global one.
+func SetProviders(tracerProvider trace.TracerProvider, meterProvider metric.MeterProvider) {
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+	if meterProvider == nil {
+		meterProvider = otel.GetMeterProvider()
+	}
+
+	meter := meterProvider.Meter(InstrumentationName)
+	i := &instruments{tracer: tracerProvider.Tracer(InstrumentationName)}
+
+	var err error
+	i.duration, err = meter.Float64Histogram(DurationMetric,
+		metric.WithDescription("Duration of armor token and password operations."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	i.failures, err = meter.Int64Counter(FailureMetric,
+		metric.WithDescription("Number of failed armor token and password operations, by reason."),
+		metric.WithUnit("{failure}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	current.Store(i)
+}
+
+// Span times one operation. It is created with Start and must be ended with End.
+type Span struct {
+	span        trace.Span
+	instruments *instruments
+	operation   Operation
+	algorithm   string
+	start       time.Time
+}
+
+// Start begins a span for operation as a child of any span in ctx.
+//
+// Parameters:
+//   - ctx: The context of the caller, e.g. a request context.
+//   - operation: The operation being performed.
+//   - algorithm: The algorithm used, e.g. "RS256", or empty if it is not yet known (see SetAlgorithm).
+//
+// Returns:
+//   - A context holding the new span, to be passed to nested operations.
+//   - The Span, which must be ended with End.
+func Start(ctx context.Context, operation Operation, algorithm string) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	i := current.Load()
+	attributes := []attribute.KeyValue{OperationKey.String(string(operation))}
+	if algorithm != "" {
+		attributes = append(attributes, AlgorithmKey.String(algorithm))
+	}
+
+	ctx, span := i.tracer.Start(ctx, string(operation), trace.WithAttributes(attributes...))
+
+	return ctx, &Span{
+		span:        span,
+		instruments: i,
+		operation:   operation,
+		algorithm:   algorithm,
+		start:       time.Now(),
+	}
+}
+
+// SetAlgorithm records the algorithm once it is known, e.g. after a token's header has been decoded.
+func (s *Span) SetAlgorithm(algorithm string) {
+	s.algorithm = algorithm
+	s.span.SetAttributes(AlgorithmKey.String(algorithm))
+}
+
+// End ends the span and records the operation's duration.
+//
+// Parameters:
+//   - err: The error the operation failed with, or nil if it succeeded.
+//   - reason: Why the operation failed, one of the Reason constants. ReasonError is used if it is empty.
+func (s *Span) End(err error, reason string) {
+	attributes := []attribute.KeyValue{OperationKey.String(string(s.operation))}
+	if s.algorithm != "" {
+		attributes = append(attributes, AlgorithmKey.String(s.algorithm))
+	}
+
+	// Measurements are recorded without the span's context, as they are not specific to a trace.
+	ctx := context.Background()
+	s.instruments.duration.Record(ctx, time.Since(s.start).Seconds(), metric.WithAttributes(attributes...))
+
+	if err != nil {
+		if reason == "" {
+			reason = ReasonError
+		}
+		s.instruments.failures.Add(ctx, 1, metric.WithAttributes(append(attributes, ReasonKey.String(reason))...))
+
+		s.span.SetAttributes(ReasonKey.String(reason))
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, reason)
+	}
+
+	s.span.End()
+}
@@ -0,0 +1,196 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError describes a configuration field that failed a rule of its `validate` tag.
+type FieldError struct {
+	// Field is the dotted Go field path, e.g. "Database.Host".
+	Field string
+	// Rule is the failed rule, e.g. "min=1".
+	Rule    string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidateStruct checks every field of config against the rules in its `validate` tag, e.g.
+//
+//	Port    int           `validate:"required,min=1,max=65535"`
+//	Mode    string        `validate:"oneof=dev staging prod"`
+//	Issuer  string        `validate:"url"`
+//	KeyFile string        `validate:"file_exists"`
+//	Timeout string        `validate:"duration"`
+//	TTL     time.Duration `validate:"min=1s,max=1h"`
+//
+// Parameters:
+//   - config: A pointer to the configuration struct to be checked. Nested structs are checked too.
+//
+// Returns:
+//   - nil if every rule passes, otherwise an error joining a *FieldError for every failed rule.
+//
+// The supported rules are:
+//   - required: the field must not be the zero value.
+//   - min=N, max=N: bounds the value of numbers and durations, or the length of strings, slices and maps.
+//   - oneof=a b c: the value must be one of the space separated options.
+//   - url: the value must be an absolute URL with a scheme and host.
+//   - file_exists: the value must be the path of an existing file.
+//   - duration: the value must be parseable by time.ParseDuration.
+//
+// Rules other than required are skipped for fields holding the zero value, so optional fields can be left unset.
+func ValidateStruct(config interface{}) error {
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("config must be a pointer to a struct")
+	}
+
+	var errs []error
+	for _, f := range configFields(v.Elem(), "") {
+		tag := f.field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		for _, rule := range strings.Split(tag, ",") {
+			rule = strings.TrimSpace(rule)
+			if rule == "" {
+				continue
+			}
+
+			if message := checkRule(f.value, rule); message != "" {
+				errs = append(errs, &FieldError{Field: f.path, Rule: rule, Message: message})
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateConfiguration runs ValidateStruct and then, if every tag rule passed, the configuration's
+// own Validate method.
+func validateConfiguration(config Configuration) error {
+	if err := ValidateStruct(config); err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+
+	return nil
+}
+
+// checkRule returns a description of why v fails rule, or "" if it passes.
+func checkRule(v reflect.Value, rule string) string {
+	name, arg, _ := strings.Cut(rule, "=")
+
+	if name == "required" {
+		if v.IsZero() {
+			return "is required"
+		}
+		return ""
+	}
+
+	if v.IsZero() {
+		if _, known := ruleNames[name]; !known {
+			return fmt.Sprintf("unknown validation rule %q", name)
+		}
+		return ""
+	}
+
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+
+	switch name {
+	case "min", "max":
+		return checkBound(v, name, arg)
+	case "oneof":
+		value := fmt.Sprint(v.Interface())
+		for _, option := range strings.Fields(arg) {
+			if value == option {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s]", arg)
+	case "url":
+		u, err := url.Parse(fmt.Sprint(v.Interface()))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "must be an absolute URL"
+		}
+	case "file_exists":
+		info, err := os.Stat(fmt.Sprint(v.Interface()))
+		if err != nil || info.IsDir() {
+			return "must be an existing file"
+		}
+	case "duration":
+		if v.Type() == durationType {
+			return ""
+		}
+		if _, err := time.ParseDuration(fmt.Sprint(v.Interface())); err != nil {
+			return "must be a duration such as 30s or 5m"
+		}
+	default:
+		return fmt.Sprintf("unknown validation rule %q", name)
+	}
+
+	return ""
+}
+
+var ruleNames = map[string]struct{}{
+	"required": {}, "min": {}, "max": {}, "oneof": {}, "url": {}, "file_exists": {}, "duration": {},
+}
+
+func checkBound(v reflect.Value, name string, arg string) string {
+	var actual, limit float64
+	var err error
+
+	switch {
+	case v.Type() == durationType:
+		var d time.Duration
+		d, err = time.ParseDuration(arg)
+		actual, limit = float64(v.Int()), float64(d)
+	case v.Kind() == reflect.String || v.Kind() == reflect.Slice || v.Kind() == reflect.Map || v.Kind() == reflect.Array:
+		limit, err = strconv.ParseFloat(arg, 64)
+		actual = float64(v.Len())
+	case v.CanInt():
+		limit, err = strconv.ParseFloat(arg, 64)
+		actual = float64(v.Int())
+	case v.CanUint():
+		limit, err = strconv.ParseFloat(arg, 64)
+		actual = float64(v.Uint())
+	case v.CanFloat():
+		limit, err = strconv.ParseFloat(arg, 64)
+		actual = v.Float()
+	default:
+		return fmt.Sprintf("%s is not supported for %s", name, v.Type())
+	}
+
+	if err != nil {
+		return fmt.Sprintf("invalid %s argument %q", name, arg)
+	}
+
+	lengthOf := ""
+	if v.Kind() == reflect.String || v.Kind() == reflect.Slice || v.Kind() == reflect.Map || v.Kind() == reflect.Array {
+		lengthOf = "length "
+	}
+
+	if name == "min" && actual < limit {
+		return fmt.Sprintf("%smust be at least %s", lengthOf, arg)
+	}
+	if name == "max" && actual > limit {
+		return fmt.Sprintf("%smust be at most %s", lengthOf, arg)
+	}
+
+	return ""
+}
@@ -0,0 +1,98 @@
+package test
+
+import (
+	"context"
+	"errors"
+	armor "github.com/bmwadforth-com/armor-go/src"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/sethvargo/go-envconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type ServiceConfig struct {
+	Name   string      `json:"name" env:"SERVICE_NAME"`
+	ApiKey util.Secret `json:"api_key"`
+}
+
+func (c *ServiceConfig) Validate() error {
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func writeServiceConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestNewCreatesIndependentInstances(t *testing.T) {
+	type ctxKey struct{}
+	coreA, logsA := observer.New(zapcore.InfoLevel)
+	coreB, logsB := observer.New(zapcore.InfoLevel)
+
+	var configA, configB ServiceConfig
+	a, err := armor.New(
+		armor.WithLogger(zap.New(coreA)),
+		armor.WithContext(context.WithValue(context.Background(), ctxKey{}, "a")),
+		armor.WithConfiguration(&configA, writeServiceConfig(t, `{"name": "orders", "api_key": "key-a"}`)),
+	)
+	require.NoError(t, err)
+	defer a.Close()
+
+	b, err := armor.New(
+		armor.WithLogger(zap.New(coreB)),
+		armor.WithLayeredConfiguration(&configB, util.LayeredOptions{
+			Env: envconfig.MapLookuper(map[string]string{"SERVICE_NAME": "billing"}),
+		}),
+	)
+	require.NoError(t, err)
+	defer b.Close()
+
+	assert.Equal(t, "orders", configA.Name)
+	assert.Equal(t, "billing", configB.Name)
+	assert.Equal(t, "a", a.Context().Value(ctxKey{}))
+	assert.Nil(t, b.Context().Value(ctxKey{}))
+	assert.Nil(t, a.ConfigReport())
+	assert.Equal(t, util.SourceEnv, b.ConfigReport()["Name"])
+
+	config, ok := armor.ConfigAs[*ServiceConfig](a)
+	require.True(t, ok)
+	assert.Same(t, &configA, config)
+
+	a.Logger().Info("from a")
+	assert.Equal(t, 1, logsA.FilterMessage("from a").Len())
+	assert.Equal(t, 0, logsB.FilterMessage("from a").Len())
+
+	// The effective configuration is logged without the secret.
+	loaded := logsA.FilterMessageSnippet("Loaded configuration").All()
+	require.Len(t, loaded, 1)
+	assert.Contains(t, loaded[0].Message, "orders")
+	assert.NotContains(t, loaded[0].Message, "key-a")
+}
+
+func TestNewReturnsConfigurationErrors(t *testing.T) {
+	var config ServiceConfig
+	_, err := armor.New(
+		armor.WithLogger(zap.NewNop()),
+		armor.WithConfiguration(&config, writeServiceConfig(t, `{"name": ""}`)),
+	)
+	assert.ErrorContains(t, err, "name is required")
+}
+
+func TestNewWithoutConfiguration(t *testing.T) {
+	a, err := armor.New(armor.WithLogger(zap.NewNop()))
+	require.NoError(t, err)
+
+	assert.Nil(t, a.Config())
+	assert.False(t, a.IsRelease())
+	assert.NoError(t, a.Close())
+}
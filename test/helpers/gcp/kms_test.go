@@ -0,0 +1,102 @@
+package gcp_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/bmwadforth-com/armor-go/src/helpers/gcp"
+	"github.com/bmwadforth-com/armor-go/src/helpers/gcp/gcptest"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const kmsKeyVersion = "projects/test/locations/global/keyRings/ring/cryptoKeys/key/cryptoKeyVersions/1"
+
+func newKMSKey(t *testing.T, privateKey crypto.Signer) (*gcp.KMSKey, *gcptest.KMS) {
+	fake := gcptest.NewKMS()
+	fake.AddKey(kmsKeyVersion, privateKey)
+
+	kmsKey, err := gcp.NewKMSKey(context.Background(), fake, kmsKeyVersion)
+	require.NoError(t, err)
+
+	return kmsKey, fake
+}
+
+func TestKMSKeySignsRS256(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kmsKey, fake := newKMSKey(t, privateKey)
+
+	claims := common.NewClaimSet()
+	require.NoError(t, claims.Add(string(common.Subject), "svc"))
+	tokenBytes, err := jwt.NewJWSToken(common.RS256, nil).WithSigner(kmsKey).AddClaims(claims).Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, 1, fake.Calls(kmsKeyVersion))
+
+	// Verified locally against the public key; no further KMS calls.
+	builder, err := jwt.DecodeToken(string(tokenBytes), nil)
+	require.NoError(t, err)
+	valid, err := builder.WithSigner(privateKey).Validate()
+	require.NoError(t, err)
+	assert.True(t, valid)
+	assert.Equal(t, 1, fake.Calls(kmsKeyVersion))
+}
+
+func TestKMSKeySignsES256(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	kmsKey, _ := newKMSKey(t, privateKey)
+
+	claims := common.NewClaimSet()
+	require.NoError(t, claims.Add(string(common.Subject), "svc"))
+	tokenBytes, err := jwt.NewJWSToken(common.ES256, nil).WithSigner(kmsKey).AddClaims(claims).Serialize()
+	require.NoError(t, err)
+
+	builder, err := jwt.DecodeToken(string(tokenBytes), nil)
+	require.NoError(t, err)
+	valid, err := builder.WithSigner(kmsKey).Validate()
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	builder, err = jwt.DecodeToken(string(tokenBytes), nil)
+	require.NoError(t, err)
+	_, err = builder.WithSigner(otherKey).Validate()
+	assert.Error(t, err)
+}
+
+func TestKMSKeyDecryptsJWE(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kmsKey, fake := newKMSKey(t, privateKey)
+
+	suite := common.AlgorithmSuite{
+		AlgorithmType:     common.RSA_OAEP,
+		AuthAlgorithmType: common.A256GCM,
+	}
+	claims := common.NewClaimSet()
+	require.NoError(t, claims.Add(string(common.Audience), "developers"))
+	tokenBytes, err := jwt.NewJWEToken(suite, nil).WithDecrypter(kmsKey).AddClaims(claims).Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, 0, fake.Calls(kmsKeyVersion))
+
+	builder, err := jwt.DecodeToken(string(tokenBytes), nil)
+	require.NoError(t, err)
+	valid, err := builder.WithDecrypter(kmsKey).Validate()
+	require.NoError(t, err)
+	assert.True(t, valid)
+	assert.Equal(t, "developers", builder.GetClaims()[string(common.Audience)])
+	assert.Equal(t, 1, fake.Calls(kmsKeyVersion))
+}
+
+func TestKMSKeyRejectsUnknownVersion(t *testing.T) {
+	_, err := gcp.NewKMSKey(context.Background(), gcptest.NewKMS(), kmsKeyVersion)
+	assert.Error(t, err)
+}
@@ -0,0 +1,41 @@
+package gcp_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/bmwadforth-com/armor-go/src/helpers/gcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSecretManagerSourceAccessSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "projects/test/secrets/db-password/versions/latest:access") {
+			http.NotFound(w, r)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":    "projects/test/secrets/db-password/versions/3",
+			"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte("s3cret"))},
+		})
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	source, err := gcp.NewSecretManagerSource(ctx, option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	secret, err := source.AccessSecret(ctx, "projects/test/secrets/db-password/versions/latest")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", string(secret))
+
+	_, err = source.AccessSecret(ctx, "projects/test/secrets/missing/versions/latest")
+	assert.Error(t, err)
+}
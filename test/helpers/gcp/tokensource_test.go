@@ -0,0 +1,131 @@
+package gcp_test
+
+import (
+	"context"
+	"github.com/bmwadforth-com/armor-go/src/helpers/gcp"
+	"github.com/bmwadforth-com/armor-go/src/helpers/gcp/gcptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newMetadataServer(t *testing.T) *gcptest.MetadataServer {
+	metadata, err := gcptest.NewMetadataServer()
+	require.NoError(t, err)
+	t.Cleanup(metadata.Close)
+	t.Setenv(gcp.MetadataHostEnv, metadata.Host())
+
+	return metadata
+}
+
+func TestIdentityTokenCacheReusesTokens(t *testing.T) {
+	ctx := context.Background()
+	metadata := newMetadataServer(t)
+	cache := gcp.NewIdentityTokenCache(gcp.NewMetadataTokenSource)
+
+	first, err := cache.Token(ctx, serviceAudience)
+	require.NoError(t, err)
+	second, err := cache.Token(ctx, serviceAudience)
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, metadata.Requests())
+
+	_, err = cache.Token(ctx, "https://other-service.a.run.app")
+	require.NoError(t, err)
+	assert.Equal(t, 2, metadata.Requests())
+}
+
+func TestIdentityTokenCacheRefreshesBeforeExpiry(t *testing.T) {
+	ctx := context.Background()
+	metadata := newMetadataServer(t)
+	metadata.TokenLifetime = time.Minute
+	cache := gcp.NewIdentityTokenCache(gcp.NewMetadataTokenSource)
+
+	for i := 0; i < 2; i++ {
+		_, err := cache.Token(ctx, serviceAudience)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 2, metadata.Requests())
+}
+
+func TestAuthenticatedClientSendsIdentityToken(t *testing.T) {
+	ctx := context.Background()
+	metadata := newMetadataServer(t)
+	gcp.SetIdentityTokenSource(gcp.NewMetadataTokenSource)
+	defer gcp.SetIdentityTokenSource(nil)
+
+	verifier, err := gcp.NewIdentityTokenVerifier(gcp.IdentityTokenConfig{
+		Audience:      serviceAudience,
+		AllowedEmails: []string{metadata.Email},
+		CertsURL:      metadata.Issuer.JwksURL(),
+	})
+	require.NoError(t, err)
+
+	service := httptest.NewServer(verifier.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer service.Close()
+
+	client, err := gcp.NewAuthenticatedClient(ctx, serviceAudience)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(service.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.Equal(t, 1, metadata.Requests())
+
+	token, err := gcp.GetIdentityToken(ctx, serviceAudience)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, 1, metadata.Requests())
+}
+
+func TestIdentityTokenCacheOutlivesRequestContext(t *testing.T) {
+	newMetadataServer(t)
+	var sourceCtx context.Context
+	cache := gcp.NewIdentityTokenCache(func(ctx context.Context, audience string) (oauth2.TokenSource, error) {
+		sourceCtx = ctx
+		return gcp.NewMetadataTokenSource(ctx, audience)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := cache.Token(ctx, serviceAudience)
+	require.NoError(t, err)
+	cancel()
+
+	require.NotNil(t, sourceCtx)
+	assert.NoError(t, sourceCtx.Err())
+
+	_, err = cache.Token(context.Background(), serviceAudience)
+	assert.NoError(t, err)
+}
+
+func TestSetIdentityTokenSourceConcurrentWithReaders(t *testing.T) {
+	ctx := context.Background()
+	newMetadataServer(t)
+	gcp.SetIdentityTokenSource(gcp.NewMetadataTokenSource)
+	defer gcp.SetIdentityTokenSource(nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			gcp.SetIdentityTokenSource(gcp.NewMetadataTokenSource)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := gcp.NewAuthenticatedClient(ctx, serviceAudience)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+}
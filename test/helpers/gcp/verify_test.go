@@ -0,0 +1,188 @@
+package gcp_test
+
+import (
+	"context"
+	"github.com/bmwadforth-com/armor-go/src/helpers"
+	"github.com/bmwadforth-com/armor-go/src/helpers/gcp"
+	"github.com/bmwadforth-com/armor-go/src/helpers/gcp/gcptest"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	serviceAudience = "https://orders-abc123-ts.a.run.app"
+	pushAccount     = "pubsub-push@my-project.iam.gserviceaccount.com"
+)
+
+func newGoogleIssuer(t *testing.T) (*oidctest.Issuer, *gcp.IdentityTokenVerifier) {
+	issuer, err := oidctest.NewIssuer()
+	require.NoError(t, err)
+	t.Cleanup(issuer.Close)
+
+	verifier, err := gcp.NewIdentityTokenVerifier(gcp.IdentityTokenConfig{
+		Audience:      serviceAudience,
+		AllowedEmails: []string{pushAccount},
+		CertsURL:      issuer.JwksURL(),
+	})
+	require.NoError(t, err)
+
+	return issuer, verifier
+}
+
+func googleClaims(issuer *oidctest.Issuer, email string) common.ClaimSet {
+	claims := issuer.Claims(serviceAudience, "1234567890")
+	claims[string(common.Issuer)] = "https://accounts.google.com"
+	claims["email"] = email
+	claims["email_verified"] = true
+	return claims
+}
+
+func TestVerifyGoogleIdentityToken(t *testing.T) {
+	ctx := context.Background()
+	issuer, verifier := newGoogleIssuer(t)
+
+	tokenString, err := issuer.Sign(googleClaims(issuer, pushAccount))
+	require.NoError(t, err)
+
+	claims, err := verifier.Verify(ctx, tokenString)
+	require.NoError(t, err)
+	assert.Equal(t, pushAccount, claims["email"])
+
+	other, err := issuer.Sign(googleClaims(issuer, "someone@my-project.iam.gserviceaccount.com"))
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, other)
+	assert.Error(t, err)
+
+	wrongAudience := googleClaims(issuer, pushAccount)
+	wrongAudience[string(common.Audience)] = "https://other-service.a.run.app"
+	tokenString, err = issuer.Sign(wrongAudience)
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, tokenString)
+	assert.Error(t, err)
+
+	unverified := googleClaims(issuer, pushAccount)
+	delete(unverified, "email_verified")
+	tokenString, err = issuer.Sign(unverified)
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, tokenString)
+	assert.Error(t, err)
+
+	splitAudience := googleClaims(issuer, pushAccount)
+	splitAudience[string(common.Audience)] = "https://other-service.a.run.app " + serviceAudience
+	tokenString, err = issuer.Sign(splitAudience)
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, tokenString)
+	assert.Error(t, err)
+
+	audienceList := googleClaims(issuer, pushAccount)
+	audienceList[string(common.Audience)] = []interface{}{"https://other-service.a.run.app", serviceAudience}
+	tokenString, err = issuer.Sign(audienceList)
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, tokenString)
+	assert.NoError(t, err)
+
+	selfIssued := issuer.Claims(serviceAudience, "1234567890")
+	tokenString, err = issuer.Sign(selfIssued)
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, tokenString)
+	assert.Error(t, err)
+}
+
+func TestIdentityTokenMiddleware(t *testing.T) {
+	issuer, verifier := newGoogleIssuer(t)
+	handler := verifier.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := helpers.ClaimsFromContext(r.Context())
+		assert.True(t, ok)
+		assert.Equal(t, pushAccount, claims["email"])
+	}))
+
+	tokenString, err := issuer.Sign(googleClaims(issuer, pushAccount))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/push", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/push", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestIdentityTokenValidatorUsesRequestContext(t *testing.T) {
+	issuer, verifier := newGoogleIssuer(t)
+
+	tokenString, err := issuer.Sign(googleClaims(issuer, pushAccount))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = verifier.TokenValidator()(ctx, tokenString)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	claims, err := verifier.TokenValidator()(context.Background(), tokenString)
+	require.NoError(t, err)
+	assert.Equal(t, pushAccount, claims["email"])
+}
+
+func TestVerifyIAPAssertion(t *testing.T) {
+	const (
+		iapAudience = "/projects/123456789/global/backendServices/987654321"
+		user        = "jane@example.com"
+	)
+
+	iap, err := gcptest.NewIAP()
+	require.NoError(t, err)
+	t.Cleanup(iap.Close)
+
+	verifier, err := gcp.NewIAPTokenVerifier(gcp.IdentityTokenConfig{
+		Audience:      iapAudience,
+		AllowedEmails: []string{user},
+		CertsURL:      iap.CertsURL(),
+	})
+	require.NoError(t, err)
+
+	handler := verifier.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := helpers.ClaimsFromContext(r.Context())
+		assert.True(t, ok)
+		assert.Equal(t, user, claims["email"])
+	}))
+
+	tokenString, err := iap.Sign(iap.Claims(iapAudience, user))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(gcp.IAPAssertionHeader, tokenString)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	for _, claims := range []common.ClaimSet{
+		iap.Claims(iapAudience, "mallory@example.com"),
+		iap.Claims("/projects/123456789/global/backendServices/1", user),
+	} {
+		tokenString, err := iap.Sign(claims)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(gcp.IAPAssertionHeader, tokenString)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+
+	google, err := oidctest.NewIssuer()
+	require.NoError(t, err)
+	t.Cleanup(google.Close)
+
+	rs256, err := google.Sign(iap.Claims(iapAudience, user))
+	require.NoError(t, err)
+	_, err = verifier.Verify(context.Background(), rs256)
+	assert.Error(t, err)
+}
@@ -0,0 +1,33 @@
+package helpers_test
+
+import (
+	"github.com/bmwadforth-com/armor-go/src/helpers"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+)
+
+func TestNewHS256BearerTokenLogsClaimNamesOnly(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger, sLogger := util.Logger, util.SLogger
+	util.Logger = zap.New(core)
+	util.SLogger = util.Logger.Sugar()
+	t.Cleanup(func() {
+		util.Logger, util.SLogger = logger, sLogger
+	})
+
+	_, err := helpers.NewHS256BearerToken(middlewareKey, common.ClaimSet{
+		string(common.Subject): "user-42",
+		"email":                "ada@example.com",
+	})
+	require.NoError(t, err)
+
+	entries := logs.FilterMessageSnippet("new token generated").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "[ARMOR]: new token generated with claims: email, jti, sub", entries[0].Message)
+}
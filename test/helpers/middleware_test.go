@@ -0,0 +1,125 @@
+package helpers_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/bmwadforth-com/armor-go/src/helpers"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const middlewareKey = "TEST"
+
+func serveWithToken(t *testing.T, handler http.Handler, claims common.ClaimSet) int {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if claims != nil {
+		token, err := helpers.NewHS256BearerToken(middlewareKey, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec.Code
+}
+
+func TestBearerTokenMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, found := helpers.ClaimsFromContext(r.Context())
+		assert.True(t, found)
+		assert.Equal(t, "developers", claims[string(common.Audience)])
+	})
+	handler := helpers.HS256BearerTokenMiddleware(middlewareKey)(ok)
+
+	assert.Equal(t, http.StatusOK, serveWithToken(t, handler, common.ClaimSet{string(common.Audience): "developers"}))
+	assert.Equal(t, http.StatusUnauthorized, serveWithToken(t, handler, nil))
+}
+
+func TestRequireScopesAndRoles(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	authenticate := helpers.HS256BearerTokenMiddleware(middlewareKey)
+	scoped := authenticate(helpers.RequireScopes("orders.read")(ok))
+	admin := authenticate(helpers.RequireAnyRole("admin")(ok))
+
+	reader := common.ClaimSet{string(common.Scope): "orders.read"}
+	assert.Equal(t, http.StatusOK, serveWithToken(t, scoped, reader))
+	assert.Equal(t, http.StatusForbidden, serveWithToken(t, admin, reader))
+
+	administrator := common.ClaimSet{string(common.Roles): []string{"admin"}}
+	assert.Equal(t, http.StatusOK, serveWithToken(t, admin, administrator))
+	assert.Equal(t, http.StatusForbidden, serveWithToken(t, scoped, administrator))
+
+	assert.Equal(t, http.StatusUnauthorized, serveWithToken(t, helpers.RequireScopes("orders.read")(ok), nil))
+}
+
+// forgeToken builds an unsigned token with the given header algorithm, as an attacker would.
+func forgeToken(t *testing.T, algorithm string, claims common.ClaimSet) string {
+	header, err := json.Marshal(map[string]string{"alg": algorithm, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+func TestBearerTokenMiddlewareRejectsForgedAlgorithm(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	admin := helpers.HS256BearerTokenMiddleware(middlewareKey)(helpers.RequireAnyRole("admin")(ok))
+
+	for _, algorithm := range []string{"none", "RS256"} {
+		token := forgeToken(t, algorithm, common.ClaimSet{string(common.Roles): []string{"admin"}})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, algorithm)
+		assert.False(t, helpers.ValidateHS256BearerToken(middlewareKey, token), algorithm)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var requestID string
+	handler := helpers.RequestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID, _ = util.RequestIDFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(helpers.RequestIDHeader, "req-from-client")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "req-from-client", requestID)
+	assert.Equal(t, "req-from-client", rec.Header().Get(helpers.RequestIDHeader))
+
+	// Missing or unsafe IDs are replaced with a generated one.
+	for _, header := range []string{"", "bad id\n"} {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(helpers.RequestIDHeader, header)
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Len(t, requestID, 32)
+		assert.Equal(t, requestID, rec.Header().Get(helpers.RequestIDHeader))
+	}
+}
+
+func TestBearerTokenMiddlewareAddsSubjectToContext(t *testing.T) {
+	var subject string
+	handler := helpers.HS256BearerTokenMiddleware(middlewareKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, _ = util.SubjectFromContext(r.Context())
+	}))
+
+	assert.Equal(t, http.StatusOK, serveWithToken(t, handler, common.ClaimSet{string(common.Subject): "user-42"}))
+	assert.Equal(t, "user-42", subject)
+}
@@ -0,0 +1,140 @@
+package helpers_test
+
+import (
+	"github.com/bmwadforth-com/armor-go/src/helpers"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceContext(t *testing.T) {
+	cases := []struct {
+		name     string
+		header   string
+		value    string
+		expected helpers.TraceContext
+		ok       bool
+	}{
+		{"traceparent", helpers.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			helpers.TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}, true},
+		{"traceparent not sampled", helpers.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			helpers.TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}, true},
+		{"traceparent zero trace", helpers.TraceparentHeader, "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			helpers.TraceContext{}, false},
+		{"traceparent uppercase", helpers.TraceparentHeader, "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			helpers.TraceContext{}, false},
+		{"cloud trace", helpers.CloudTraceContextHeader, "105445aa7843bc8bf206b12000100000/1;o=1",
+			helpers.TraceContext{TraceID: "105445aa7843bc8bf206b12000100000", SpanID: "0000000000000001", Sampled: true}, true},
+		{"cloud trace without span", helpers.CloudTraceContextHeader, "105445aa7843bc8bf206b12000100000",
+			helpers.TraceContext{TraceID: "105445aa7843bc8bf206b12000100000"}, true},
+		{"cloud trace malformed span", helpers.CloudTraceContextHeader, "105445aa7843bc8bf206b12000100000/abc;o=1",
+			helpers.TraceContext{}, false},
+		{"missing", "", "", helpers.TraceContext{}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			header := http.Header{}
+			if c.header != "" {
+				header.Set(c.header, c.value)
+			}
+
+			tc, ok := helpers.ParseTraceContext(header)
+			assert.Equal(t, c.ok, ok)
+			assert.Equal(t, c.expected, tc)
+		})
+	}
+}
+
+func TestParseTraceContextPrefersTraceparent(t *testing.T) {
+	header := http.Header{}
+	header.Set(helpers.CloudTraceContextHeader, "105445aa7843bc8bf206b12000100000/1;o=1")
+	header.Set(helpers.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	tc, ok := helpers.ParseTraceContext(header)
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tc.TraceID)
+}
+
+func TestTraceAndRequestLoggingMiddleware(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger, sLogger := util.Logger, util.SLogger
+	util.Logger = zap.New(core)
+	util.SLogger = util.Logger.Sugar()
+	t.Cleanup(func() {
+		util.Logger, util.SLogger = logger, sLogger
+	})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		util.LogInfoCtx(r.Context(), "handling")
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("short and stout"))
+	})
+	wrapped := helpers.TraceMiddleware("my-project")(helpers.RequestLoggingMiddleware(2)(handler))
+
+	req := httptest.NewRequest(http.MethodGet, "/pots?size=small", nil)
+	req.Header.Set(helpers.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	wrapped.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		assert.Equal(t, "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736", entry.ContextMap()[util.CloudTraceKey])
+		assert.Equal(t, "00f067aa0ba902b7", entry.ContextMap()[util.CloudSpanIDKey])
+	}
+
+	assert.Equal(t, "[ARMOR]: GET /pots 418", entries[1].Message)
+	assert.Equal(t, zapcore.WarnLevel, entries[1].Level)
+	request, ok := entries[1].ContextMap()[util.CloudHTTPRequestKey].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "/pots?size=small", request["requestUrl"])
+	assert.Equal(t, 418, request["status"])
+	assert.Equal(t, "15", request["responseSize"])
+	assert.Equal(t, "203.0.113.7", request["remoteIp"])
+}
+
+func TestRequestLoggingMiddlewareIgnoresSpoofedForwardedFor(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger, sLogger := util.Logger, util.SLogger
+	util.Logger = zap.New(core)
+	util.SLogger = util.Logger.Sugar()
+	t.Cleanup(func() {
+		util.Logger, util.SLogger = logger, sLogger
+	})
+
+	testCases := []struct {
+		trustedHops int
+		forwarded   []string
+		expected    string
+	}{
+		{trustedHops: 2, forwarded: []string{"198.51.100.1, 203.0.113.7, 10.0.0.1"}, expected: "203.0.113.7"},
+		{trustedHops: 2, forwarded: []string{"198.51.100.1", "203.0.113.7, 10.0.0.1"}, expected: "203.0.113.7"},
+		{trustedHops: 1, forwarded: []string{"198.51.100.1, 203.0.113.7"}, expected: "203.0.113.7"},
+		{trustedHops: 2, forwarded: []string{"203.0.113.7"}, expected: "203.0.113.7"},
+		{trustedHops: 0, forwarded: []string{"198.51.100.1"}, expected: "192.0.2.1"},
+	}
+
+	for _, tc := range testCases {
+		logs.TakeAll()
+		handler := helpers.RequestLoggingMiddleware(tc.trustedHops)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, value := range tc.forwarded {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		entries := logs.All()
+		require.Len(t, entries, 1)
+		request, ok := entries[0].ContextMap()[util.CloudHTTPRequestKey].(map[string]interface{})
+		require.True(t, ok)
+		assert.Equal(t, tc.expected, request["remoteIp"], "%d hops, %v", tc.trustedHops, tc.forwarded)
+	}
+}
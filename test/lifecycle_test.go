@@ -0,0 +1,135 @@
+package test
+
+import (
+	"context"
+	"errors"
+	armor "github.com/bmwadforth-com/armor-go/src"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"os"
+	"os/signal"
+	"testing"
+	"time"
+)
+
+func TestShutdownRunsHooksInReverseOrder(t *testing.T) {
+	a, err := armor.New(armor.WithLogger(zap.NewNop()))
+	require.NoError(t, err)
+
+	var order []string
+	for _, name := range []string{"database", "cache", "server"} {
+		name := name
+		a.OnShutdown(name, func(ctx context.Context) error {
+			assert.Error(t, a.Context().Err(), "context is cancelled before hooks run")
+			order = append(order, name)
+			return nil
+		})
+	}
+
+	require.NoError(t, a.Shutdown(context.Background()))
+	assert.Equal(t, []string{"server", "cache", "database"}, order)
+
+	// Later calls return the first result without running the hooks again.
+	require.NoError(t, a.Shutdown(context.Background()))
+	assert.Len(t, order, 3)
+}
+
+func TestShutdownJoinsHookErrors(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	a, err := armor.New(armor.WithLogger(zap.New(core)))
+	require.NoError(t, err)
+
+	ran := false
+	a.OnShutdown("first", func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	a.OnShutdown("panics", func(ctx context.Context) error {
+		panic("boom")
+	})
+	a.OnShutdown("fails", func(ctx context.Context) error {
+		return errors.New("connection reset")
+	})
+
+	err = a.Shutdown(context.Background())
+	assert.ErrorContains(t, err, "shutdown hook fails: connection reset")
+	assert.ErrorContains(t, err, "shutdown hook panics: panic: boom")
+	assert.True(t, ran)
+	assert.Equal(t, 2, logs.FilterLevelExact(zapcore.ErrorLevel).Len())
+}
+
+func TestShutdownSkipsHooksAfterDeadline(t *testing.T) {
+	a, err := armor.New(armor.WithLogger(zap.NewNop()), armor.WithShutdownTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+
+	skipped := true
+	a.OnShutdown("skipped", func(ctx context.Context) error {
+		skipped = false
+		return nil
+	})
+	a.OnShutdown("blocks", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	err = a.Shutdown(context.Background())
+	assert.Less(t, time.Since(start), time.Second)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "shutdown hook skipped skipped")
+	assert.True(t, skipped)
+}
+
+func TestWaitShutsDownOnSignal(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	a, err := armor.New(armor.WithLogger(zap.New(core)), armor.WithSignals(os.Interrupt))
+	require.NoError(t, err)
+
+	closed := make(chan struct{})
+	a.OnShutdown("server", func(ctx context.Context) error {
+		close(closed)
+		return nil
+	})
+
+	process, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, process.Signal(os.Interrupt))
+
+	require.NoError(t, a.Wait())
+	assert.ErrorIs(t, a.Context().Err(), context.Canceled)
+	assert.Equal(t, 1, logs.FilterMessageSnippet("Shutting down").Len())
+
+	select {
+	case <-closed:
+	default:
+		t.Fatal("shutdown hook did not run")
+	}
+}
+
+func TestInitArmorLeavesSignalsAloneByDefault(t *testing.T) {
+	t.Cleanup(func() { armor.Signals = nil })
+
+	// Receive SIGINT here as well, so that the default behaviour does not terminate the test binary.
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, os.Interrupt)
+	defer signal.Stop(received)
+
+	process, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+
+	config := &ServiceConfig{}
+	require.NoError(t, armor.InitArmor(false, zapcore.DebugLevel, &config, writeServiceConfig(t, `{"name": "orders"}`)))
+	require.NoError(t, process.Signal(os.Interrupt))
+	<-received
+	assert.NoError(t, armor.ArmorContext.Err(), "InitArmor should not handle signals unless Signals is set")
+
+	armor.Signals = []os.Signal{os.Interrupt}
+	config = &ServiceConfig{}
+	require.NoError(t, armor.InitArmor(false, zapcore.DebugLevel, &config, writeServiceConfig(t, `{"name": "orders"}`)))
+	require.NoError(t, process.Signal(os.Interrupt))
+	<-received
+	assert.Eventually(t, func() bool { return armor.ArmorContext.Err() != nil }, 5*time.Second, 10*time.Millisecond)
+}
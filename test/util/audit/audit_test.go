@@ -0,0 +1,312 @@
+package audit_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/bmwadforth-com/armor-go/src/util/audit"
+	"github.com/bmwadforth-com/armor-go/src/util/crypto"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jwk"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordEvents replaces the audit sink for the duration of the test, returning a function that lists the
+// events emitted so far.
+func recordEvents(t *testing.T) func() []audit.Event {
+	var mu sync.Mutex
+	var events []audit.Event
+
+	previous := audit.CurrentSink()
+	audit.SetSink(audit.SinkFunc(func(_ context.Context, event audit.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+		return nil
+	}))
+	t.Cleanup(func() {
+		audit.SetSink(previous)
+	})
+
+	return func() []audit.Event {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]audit.Event{}, events...)
+	}
+}
+
+func TestEmitFillsContext(t *testing.T) {
+	events := recordEvents(t)
+
+	ctx := util.ContextWithTrace(util.ContextWithRequestID(context.Background(), "req-1"), "", "trace-1", "", false)
+	audit.Emit(ctx, audit.Event{Type: audit.KeyRotated, KeyIDs: []string{"k2"}})
+
+	emitted := events()
+	require.Len(t, emitted, 1)
+	assert.Equal(t, audit.KeyRotated, emitted[0].Type)
+	assert.Equal(t, "req-1", emitted[0].RequestID)
+	assert.Equal(t, "trace-1", emitted[0].TraceID)
+	assert.WithinDuration(t, time.Now(), emitted[0].Time, time.Minute)
+}
+
+func TestEmitWithoutSink(t *testing.T) {
+	previous := audit.CurrentSink()
+	t.Cleanup(func() {
+		audit.SetSink(previous)
+	})
+
+	audit.SetSink(nil)
+	assert.NotPanics(t, func() {
+		audit.Emit(context.Background(), audit.Event{Type: audit.TokenIssued})
+	})
+}
+
+func TestLoggerSink(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger, sLogger := util.Logger, util.SLogger
+	util.SetLogger(zap.New(core))
+	t.Cleanup(func() {
+		util.Logger, util.SLogger = logger, sLogger
+	})
+
+	ctx := util.ContextWithRequestID(context.Background(), "req-1")
+	require.NoError(t, audit.NewLoggerSink().Write(ctx, audit.Event{Type: audit.TokenIssued, Subject: "user-42"}))
+
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "[ARMOR]: Audit token.issued", entries[0].Message)
+	assert.Equal(t, "req-1", entries[0].ContextMap()[util.LogFieldRequestID])
+	event, ok := entries[0].ContextMap()["audit"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "user-42", event["subject"])
+}
+
+func TestFileSinkAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "events.jsonl")
+
+	for _, subject := range []string{"first", "second"} {
+		sink, err := audit.NewFileSink(path)
+		require.NoError(t, err)
+		require.NoError(t, sink.Write(context.Background(), audit.Event{Type: audit.TokenIssued, Subject: subject}))
+		require.NoError(t, sink.Close())
+		assert.Error(t, sink.Write(context.Background(), audit.Event{Type: audit.TokenIssued}))
+	}
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var subjects []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event audit.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		subjects = append(subjects, event.Subject)
+	}
+	assert.Equal(t, []string{"first", "second"}, subjects)
+}
+
+func TestChannelAndMultiSink(t *testing.T) {
+	ch := make(chan audit.Event, 1)
+	failing := audit.SinkFunc(func(context.Context, audit.Event) error {
+		return errors.New("unavailable")
+	})
+	sink := audit.NewMultiSink(audit.NewChannelSink(ch), failing)
+
+	err := sink.Write(context.Background(), audit.Event{Type: audit.TokenValidated})
+	assert.ErrorContains(t, err, "unavailable")
+	assert.Equal(t, audit.TokenValidated, (<-ch).Type)
+
+	// A full channel gives up when the context is done.
+	ch <- audit.Event{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, audit.NewChannelSink(ch).Write(ctx, audit.Event{}), context.Canceled)
+}
+
+func TestTokenEvents(t *testing.T) {
+	events := recordEvents(t)
+	key := []byte("audit-test-key")
+
+	token, err := jwt.NewJWSToken(common.HS256, key).AddClaims(common.ClaimSet{string(common.Subject): "user-42"}).Serialize()
+	require.NoError(t, err)
+
+	tokenBuilder, err := jwt.DecodeToken(token, key)
+	require.NoError(t, err)
+	ctx := util.ContextWithRequestID(context.Background(), "req-1")
+	_, err = tokenBuilder.ValidateContext(ctx)
+	require.NoError(t, err)
+
+	tokenBuilder, err = jwt.DecodeToken(token, []byte("wrong-key"))
+	require.NoError(t, err)
+	_, err = tokenBuilder.Validate()
+	require.Error(t, err)
+
+	_, err = jwt.DecodeToken("not-a-token", key)
+	require.Error(t, err)
+
+	emitted := events()
+	require.Len(t, emitted, 4)
+
+	assert.Equal(t, audit.TokenIssued, emitted[0].Type)
+	assert.Equal(t, "user-42", emitted[0].Subject)
+	assert.NotEmpty(t, emitted[0].TokenID)
+	assert.Equal(t, "HS256", emitted[0].Algorithm)
+
+	claims := tokenBuilder.GetClaims()
+	jti, _ := claims.JwtID()
+	assert.Equal(t, audit.HashTokenID(jti), emitted[0].TokenID)
+	assert.NotEqual(t, jti, emitted[0].TokenID)
+
+	assert.Equal(t, audit.TokenValidated, emitted[1].Type)
+	assert.Equal(t, "user-42", emitted[1].Subject)
+	assert.Equal(t, emitted[0].TokenID, emitted[1].TokenID)
+	assert.Equal(t, "req-1", emitted[1].RequestID)
+
+	assert.Equal(t, audit.TokenValidationFailed, emitted[2].Type)
+	assert.NotEmpty(t, emitted[2].Reason)
+	assert.Empty(t, emitted[2].Subject, "unverified claims are not trusted")
+
+	assert.Equal(t, audit.TokenValidationFailed, emitted[3].Type)
+	assert.Contains(t, emitted[3].Reason, "failed to decode token")
+
+	for _, event := range emitted {
+		assert.NotContains(t, event.Reason, token)
+	}
+}
+
+func TestUnsupportedAlgorithmNotAudited(t *testing.T) {
+	events := recordEvents(t)
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"x-attacker-chosen","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{}`))
+	tokenBuilder, err := jwt.DecodeToken(header+"."+payload+".c2lnbmF0dXJl", []byte("audit-test-key"))
+	require.NoError(t, err)
+	_, err = tokenBuilder.Validate()
+	require.Error(t, err)
+
+	emitted := events()
+	require.Len(t, emitted, 1)
+	assert.Equal(t, audit.TokenValidationFailed, emitted[0].Type)
+	assert.Equal(t, "unknown", emitted[0].Algorithm)
+}
+
+func TestPasswordVerificationFailedEvent(t *testing.T) {
+	events := recordEvents(t)
+
+	hash, err := crypto.HashPassword([]byte("correct horse"))
+	require.NoError(t, err)
+
+	match, _ := crypto.PasswordHashMatch(hash, []byte("correct horse"))
+	assert.True(t, match)
+	match, _ = crypto.PasswordHashMatch(hash, []byte("battery staple"))
+	assert.False(t, match)
+
+	emitted := events()
+	require.Len(t, emitted, 1)
+	assert.Equal(t, audit.PasswordVerificationFailed, emitted[0].Type)
+	assert.NotContains(t, emitted[0].Reason, "battery staple")
+}
+
+func TestKeyRotatedEvent(t *testing.T) {
+	events := recordEvents(t)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	set := jwk.Set{Keys: []jwk.Key{jwk.NewRSAKey("k1", "RS256", &privateKey.PublicKey)}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	defer server.Close()
+
+	remote := jwk.NewRemoteSet(server.URL, server.Client())
+	_, err = remote.Keys(context.Background(), "k1")
+	require.NoError(t, err)
+
+	// Refreshing an unchanged set is not a rotation.
+	require.NoError(t, remote.Refresh(context.Background()))
+	assert.Empty(t, events())
+
+	mu.Lock()
+	set.Keys = append(set.Keys, jwk.NewRSAKey("k2", "RS256", &privateKey.PublicKey))
+	mu.Unlock()
+	require.NoError(t, remote.Refresh(context.Background()))
+
+	emitted := events()
+	require.Len(t, emitted, 1)
+	assert.Equal(t, audit.KeyRotated, emitted[0].Type)
+	assert.Equal(t, []string{"k1", "k2"}, emitted[0].KeyIDs)
+}
+
+func TestRefreshTokenIdentifiersNotAudited(t *testing.T) {
+	events := recordEvents(t)
+	ctx := context.Background()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	service, err := session.NewService(session.Config{
+		SigningAlgorithm:   common.HS256,
+		SigningKey:         []byte("audit-test-key"),
+		RefreshTokenFormat: session.JWE,
+		RefreshDecrypter:   privateKey,
+	})
+	require.NoError(t, err)
+
+	pair, err := service.Issue(ctx, common.ClaimSet{string(common.Subject): "user-42"})
+	require.NoError(t, err)
+	rotated, err := service.Refresh(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+	_, err = service.Refresh(ctx, pair.RefreshToken)
+	require.ErrorIs(t, err, session.ErrRefreshTokenReused)
+	emitted := events()
+
+	// Everything that could identify a refresh token.
+	var secrets []string
+	for _, refreshToken := range []string{pair.RefreshToken, rotated.RefreshToken} {
+		tokenBuilder, err := jwt.DecodeToken(refreshToken, nil)
+		require.NoError(t, err)
+		_, err = tokenBuilder.WithDecrypter(privateKey).Validate()
+		require.NoError(t, err)
+
+		claims := tokenBuilder.GetClaims()
+		jti, _ := claims.JwtID()
+		secret, _ := claims.GetString(session.SecretClaim)
+		secrets = append(secrets, refreshToken, jti, audit.HashTokenID(jti), secret, audit.HashTokenID(secret))
+	}
+
+	require.NotEmpty(t, emitted)
+	for _, event := range emitted {
+		line, err := json.Marshal(event)
+		require.NoError(t, err)
+		for _, secret := range secrets {
+			assert.False(t, strings.Contains(string(line), secret), "refresh token identifier in %s", line)
+		}
+
+		if event.Algorithm == "RSA-OAEP/A256GCM" {
+			assert.Empty(t, event.TokenID)
+		}
+	}
+}
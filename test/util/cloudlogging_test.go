@@ -0,0 +1,105 @@
+package util_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureCloudLogs replaces the global logger with a release logger writing to a buffer for the duration of
+// the test, returning a function that decodes the lines written so far.
+func captureCloudLogs(t *testing.T) func() []map[string]interface{} {
+	var buf bytes.Buffer
+	logger, sLogger := util.Logger, util.SLogger
+	util.Logger = zap.New(util.NewCloudLoggingCore(zapcore.AddSync(&buf), zapcore.DebugLevel), zap.AddCaller())
+	util.SLogger = util.Logger.Sugar()
+	t.Cleanup(func() {
+		util.Logger, util.SLogger = logger, sLogger
+	})
+
+	return func() []map[string]interface{} {
+		var entries []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var entry map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+}
+
+func TestCloudLoggingTraceFields(t *testing.T) {
+	entries := captureCloudLogs(t)
+
+	ctx := util.ContextWithTrace(context.Background(), "my-project", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true)
+	util.LogWarnCtx(ctx, "slow query")
+
+	logged := entries()
+	require.Len(t, logged, 1)
+	assert.Equal(t, "WARNING", logged[0]["severity"])
+	assert.Equal(t, "[ARMOR]: slow query", logged[0]["message"])
+	assert.Equal(t, "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736", logged[0][util.CloudTraceKey])
+	assert.Equal(t, "00f067aa0ba902b7", logged[0][util.CloudSpanIDKey])
+	assert.Equal(t, true, logged[0][util.CloudTraceSampledKey])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", logged[0][util.LogFieldTraceID])
+}
+
+func TestCloudLoggingTraceWithoutProject(t *testing.T) {
+	ctx := util.ContextWithTrace(context.Background(), "", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true)
+
+	fields := util.LogFieldsFromContext(ctx)
+	require.Len(t, fields, 1)
+	assert.Equal(t, util.LogFieldTraceID, fields[0].Key)
+}
+
+func TestCloudLoggingSourceLocation(t *testing.T) {
+	entries := captureCloudLogs(t)
+
+	util.LogInfo("from the wrapper")
+	util.LogInfoCtx(context.Background(), "from the context wrapper")
+	util.Logger.Info("from zap")
+	slog.New(util.NewSlogHandler(util.Logger)).Info("from slog")
+
+	logged := entries()
+	require.Len(t, logged, 4)
+	for _, entry := range logged {
+		location, ok := entry[util.CloudSourceLocationKey].(map[string]interface{})
+		require.True(t, ok, "missing source location in %v", entry)
+		assert.True(t, strings.HasSuffix(location["file"].(string), "test/util/cloudlogging_test.go"), location["file"])
+		assert.NotEmpty(t, location["line"])
+		assert.Contains(t, location["function"], "TestCloudLoggingSourceLocation")
+	}
+}
+
+func TestCloudLoggingHTTPRequest(t *testing.T) {
+	entries := captureCloudLogs(t)
+
+	util.Logger.Info("request", util.HTTPRequestField(util.HTTPRequest{
+		Method:       "POST",
+		URL:          "/orders?id=1",
+		Status:       201,
+		ResponseSize: 42,
+		RemoteIP:     "203.0.113.7",
+		Latency:      1500 * time.Millisecond,
+	}))
+
+	logged := entries()
+	require.Len(t, logged, 1)
+	assert.Equal(t, map[string]interface{}{
+		"requestMethod": "POST",
+		"requestUrl":    "/orders?id=1",
+		"status":        float64(201),
+		"responseSize":  "42",
+		"remoteIp":      "203.0.113.7",
+		"latency":       "1.500000000s",
+	}, logged[0][util.CloudHTTPRequestKey])
+}
@@ -0,0 +1,101 @@
+package util_test
+
+import (
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type FormatConfig struct {
+	Name     string   `json:"name" env:"APP_NAME"`
+	Replicas int      `json:"replicas" env:"APP_REPLICAS"`
+	Tags     []string `json:"tags"`
+	Database struct {
+		Host string `json:"host" env:"DB_HOST"`
+		Port int    `json:"port" env:"DB_PORT"`
+	} `json:"database"`
+}
+
+func (c *FormatConfig) Validate() error {
+	return nil
+}
+
+func TestDetectConfigFormat(t *testing.T) {
+	testCases := map[string]util.ConfigFormat{
+		"config.json":          util.FormatJSON,
+		"config.yaml":          util.FormatYAML,
+		"/etc/app/CONFIG.YML":  util.FormatYAML,
+		"config.toml":          util.FormatTOML,
+		".env":                 util.FormatDotenv,
+		".env.local":           util.FormatDotenv,
+		"staging.env":          util.FormatDotenv,
+		"test_config.json1234": util.FormatJSON,
+	}
+
+	for path, expected := range testCases {
+		assert.Equal(t, expected, util.DetectConfigFormat(path), path)
+	}
+}
+
+func TestLoadConfigurationFormats(t *testing.T) {
+	testCases := map[string]string{
+		"config.json": `{"name": "armor", "replicas": 3, "tags": ["a", "b"], "database": {"host": "db", "port": 5432}}`,
+		"config.yaml": "name: armor\nreplicas: 3\ntags: [a, b]\ndatabase:\n  host: db\n  port: 5432\n",
+		"config.toml": "name = \"armor\"\nreplicas = 3\ntags = [\"a\", \"b\"]\n\n[database]\nhost = \"db\"\nport = 5432\n",
+	}
+
+	for name, content := range testCases {
+		var config FormatConfig
+		require.NoError(t, util.LoadConfiguration(writeConfigFile(t, name, content), &config), name)
+
+		assert.Equal(t, "armor", config.Name, name)
+		assert.Equal(t, 3, config.Replicas, name)
+		assert.Equal(t, []string{"a", "b"}, config.Tags, name)
+		assert.Equal(t, "db", config.Database.Host, name)
+		assert.Equal(t, 5432, config.Database.Port, name)
+	}
+}
+
+func TestLoadConfigurationDotenv(t *testing.T) {
+	content := `
+# comment
+export APP_NAME="armor \"quoted\""
+APP_REPLICAS=3 # inline comment
+DB_HOST='literal #host'
+`
+	var config FormatConfig
+	require.NoError(t, util.LoadConfiguration(writeConfigFile(t, ".env", content), &config))
+
+	assert.Equal(t, `armor "quoted"`, config.Name)
+	assert.Equal(t, 3, config.Replicas)
+	assert.Equal(t, "literal #host", config.Database.Host)
+
+	err := util.LoadConfiguration(writeConfigFile(t, ".env", "NOT A PAIR"), &config)
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestLoadConfigurationFilesMerge(t *testing.T) {
+	base := writeConfigFile(t, "config.json", `{"name": "armor", "replicas": 1, "database": {"host": "db", "port": 5432}}`)
+	local := writeConfigFile(t, "config.local.yaml", "replicas: 2\ndatabase:\n  host: localhost\n")
+	env := writeConfigFile(t, ".env.local", "DB_PORT=6543\n")
+
+	var config FormatConfig
+	require.NoError(t, util.LoadConfigurationFiles(&config, base, local, env))
+
+	assert.Equal(t, "armor", config.Name)
+	assert.Equal(t, 2, config.Replicas)
+	assert.Equal(t, "localhost", config.Database.Host)
+	assert.Equal(t, 6543, config.Database.Port)
+}
+
+func TestLoadConfigurationFilesValidates(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "field1: \"\"\nfield2: -1\n")
+
+	var config TestConfig
+	err := util.LoadConfigurationFiles(&config, path)
+	assert.ErrorContains(t, err, "config validation failed")
+
+	err = util.LoadConfigurationFiles(&config, writeConfigFile(t, "config.toml", "field1 = "))
+	assert.ErrorContains(t, err, "config.toml")
+}
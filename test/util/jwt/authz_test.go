@@ -0,0 +1,73 @@
+package jwt
+
+import (
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/authz"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newAuthzClaims() common.ClaimSet {
+	return common.ClaimSet{
+		string(common.Scope):  "orders.read orders.write",
+		string(common.Roles):  []interface{}{"admin", "support"},
+		string(common.Groups): []interface{}{"ops"},
+		"tenant":              "acme",
+	}
+}
+
+func TestClaimSetScopesAndRoles(t *testing.T) {
+	claims := newAuthzClaims()
+
+	assert.Equal(t, []string{"orders.read", "orders.write"}, claims.Scopes())
+	assert.Equal(t, []string{"admin", "support"}, claims.Roles())
+	assert.Equal(t, []string{"ops"}, claims.Groups())
+	assert.Nil(t, common.ClaimSet{}.Scopes())
+}
+
+func TestClaimSetAudience(t *testing.T) {
+	assert.Equal(t, []string{"api://orders admin"}, common.ClaimSet{string(common.Audience): "api://orders admin"}.Audience())
+	assert.Equal(t, []string{"orders", "billing"}, common.ClaimSet{string(common.Audience): []interface{}{"orders", "billing"}}.Audience())
+	assert.Nil(t, common.ClaimSet{string(common.Audience): []interface{}{"orders", 1}}.Audience())
+	assert.Nil(t, common.ClaimSet{string(common.Audience): 1}.Audience())
+	assert.Nil(t, common.ClaimSet{}.Audience())
+}
+
+func TestHasScopesAndRoles(t *testing.T) {
+	claims := newAuthzClaims()
+
+	assert.True(t, authz.HasScopes(claims, "orders.read", "orders.write"))
+	assert.False(t, authz.HasScopes(claims, "orders.read", "orders.delete"))
+	assert.True(t, authz.HasAnyRole(claims, "viewer", "admin"))
+	assert.False(t, authz.HasAnyRole(claims, "viewer"))
+	assert.True(t, authz.HasAnyGroup(claims, "ops"))
+}
+
+func TestParsePolicy(t *testing.T) {
+	claims := newAuthzClaims()
+
+	testCases := []struct {
+		expression string
+		expected   bool
+	}{
+		{"scope:orders.read", true},
+		{"scope:orders.read and role:viewer", false},
+		{"scope:orders.read and (role:viewer or role:admin)", true},
+		{"not group:finance && claim:tenant=acme", true},
+		{"!scope:orders.read || group:finance", false},
+		{"role:viewer or role:support and scope:orders.delete", false},
+	}
+
+	for _, tc := range testCases {
+		policy, err := authz.ParsePolicy(tc.expression)
+		assert.NoError(t, err, tc.expression)
+		assert.Equal(t, tc.expected, policy(claims), tc.expression)
+	}
+}
+
+func TestParsePolicyInvalid(t *testing.T) {
+	for _, expression := range []string{"", "scope:", "unknown:x", "(scope:a", "scope:a and", "scope:a role:b"} {
+		_, err := authz.ParsePolicy(expression)
+		assert.Error(t, err, expression)
+	}
+}
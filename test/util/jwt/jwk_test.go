@@ -0,0 +1,33 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jwk"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestJwkES256RoundTrip(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	key := jwk.NewECKey("k1", string(common.ES256), &privateKey.PublicKey)
+	publicKey, err := key.PublicKey()
+	require.NoError(t, err)
+
+	signingInput := []byte("header.payload")
+	hashed := sha256.Sum256(signingInput)
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, hashed[:])
+	require.NoError(t, err)
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+
+	assert.NoError(t, jws.VerifySignature(common.ES256, signingInput, signature, publicKey))
+	assert.Error(t, jws.VerifySignature(common.ES256, []byte("tampered"), signature, publicKey))
+	assert.Error(t, jws.VerifySignature(common.RS256, signingInput, signature, publicKey))
+}
@@ -0,0 +1,209 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/oidc"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const oidcClientID = "armor-client"
+
+func newOidcVerifier(t *testing.T, config oidc.Config) (*oidctest.Issuer, *oidc.Verifier) {
+	issuer, err := oidctest.NewIssuer()
+	require.NoError(t, err)
+	t.Cleanup(issuer.Close)
+
+	provider, err := oidc.NewProvider(context.Background(), issuer.URL(), nil)
+	require.NoError(t, err)
+
+	config.ClientID = oidcClientID
+	return issuer, provider.Verifier(config)
+}
+
+func TestOidcVerifyIDToken(t *testing.T) {
+	ctx := context.Background()
+	issuer, verifier := newOidcVerifier(t, oidc.Config{MaxAge: time.Hour})
+
+	atHash, err := oidc.TokenHash(common.RS256, "access-token")
+	require.NoError(t, err)
+	cHash, err := oidc.TokenHash(common.RS256, "auth-code")
+	require.NoError(t, err)
+
+	claims := issuer.Claims(oidcClientID, "user-1")
+	claims[oidc.Nonce] = "n-0S6_WzA2Mj"
+	claims[oidc.AccessTokenHash] = atHash
+	claims[oidc.CodeHash] = cHash
+	rawIDToken, err := issuer.Sign(claims)
+	require.NoError(t, err)
+
+	idToken, err := verifier.Verify(ctx, rawIDToken,
+		oidc.WithNonce("n-0S6_WzA2Mj"), oidc.WithAccessToken("access-token"), oidc.WithCode("auth-code"))
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", idToken.Subject)
+	assert.Equal(t, []string{oidcClientID}, idToken.Audience)
+
+	_, err = verifier.Verify(ctx, rawIDToken, oidc.WithNonce("other"))
+	assert.Error(t, err)
+
+	_, err = verifier.Verify(ctx, rawIDToken, oidc.WithAccessToken("other-access-token"))
+	assert.Error(t, err)
+}
+
+func TestOidcRejectsInvalidClaims(t *testing.T) {
+	ctx := context.Background()
+	issuer, verifier := newOidcVerifier(t, oidc.Config{MaxAge: time.Minute})
+
+	testCases := map[string]func(claims common.ClaimSet){
+		"wrong audience":        func(c common.ClaimSet) { c[string(common.Audience)] = "someone-else" },
+		"wrong issuer":          func(c common.ClaimSet) { c[string(common.Issuer)] = "https://evil.example.com" },
+		"expired":               func(c common.ClaimSet) { c[string(common.ExpirationTime)] = time.Now().Add(-time.Hour).Unix() },
+		"stale auth_time":       func(c common.ClaimSet) { c[oidc.AuthTime] = time.Now().Add(-time.Hour).Unix() },
+		"multiple aud, no azp":  func(c common.ClaimSet) { c[string(common.Audience)] = []string{oidcClientID, "other"} },
+		"azp of another client": func(c common.ClaimSet) { c[oidc.AuthorizedParty] = "other" },
+		"space-delimited aud":   func(c common.ClaimSet) { c[string(common.Audience)] = "other " + oidcClientID },
+	}
+
+	for name, mutate := range testCases {
+		claims := issuer.Claims(oidcClientID, "user-1")
+		mutate(claims)
+		rawIDToken, err := issuer.Sign(claims)
+		require.NoError(t, err)
+
+		_, err = verifier.Verify(ctx, rawIDToken)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestOidcRejectsForgedSignature(t *testing.T) {
+	ctx := context.Background()
+	issuer, verifier := newOidcVerifier(t, oidc.Config{})
+
+	rawIDToken, err := issuer.Sign(issuer.Claims(oidcClientID, "user-1"))
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, rawIDToken)
+	require.NoError(t, err)
+
+	forged, err := oidctest.NewIssuer()
+	require.NoError(t, err)
+	defer forged.Close()
+
+	claims := issuer.Claims(oidcClientID, "user-1")
+	forgedToken, err := forged.Sign(claims)
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, forgedToken)
+	assert.Error(t, err)
+}
+
+func TestOidcMultiTenantIssuer(t *testing.T) {
+	ctx := context.Background()
+	issuer, err := oidctest.NewIssuer()
+	require.NoError(t, err)
+	t.Cleanup(issuer.Close)
+	issuer.MultiTenant = true
+
+	provider, err := oidc.NewProvider(ctx, issuer.URL(), nil)
+	require.NoError(t, err)
+
+	sign := func(tenant string) string {
+		claims := issuer.Claims(oidcClientID, "user-1")
+		claims[string(common.Issuer)] = issuer.TenantURL(tenant)
+		claims[oidc.TenantID] = tenant
+		rawIDToken, err := issuer.Sign(claims)
+		require.NoError(t, err)
+		return rawIDToken
+	}
+
+	verifier := provider.Verifier(oidc.Config{ClientID: oidcClientID})
+	_, err = verifier.Verify(ctx, sign("contoso"))
+	assert.Error(t, err, "tenants must be allowed explicitly")
+
+	verifier = provider.Verifier(oidc.Config{ClientID: oidcClientID, AllowedTenants: []string{"contoso"}})
+	idToken, err := verifier.Verify(ctx, sign("contoso"))
+	require.NoError(t, err)
+	assert.Equal(t, issuer.TenantURL("contoso"), idToken.Issuer)
+	_, err = verifier.Verify(ctx, sign("fabrikam"))
+	assert.Error(t, err)
+
+	verifier = provider.Verifier(oidc.Config{ClientID: oidcClientID, AllowAnyTenant: true})
+	_, err = verifier.Verify(ctx, sign("fabrikam"))
+	assert.NoError(t, err)
+	_, err = verifier.Verify(ctx, sign(""))
+	assert.Error(t, err)
+}
+
+func TestOidcTokenHashWithES256(t *testing.T) {
+	ctx := context.Background()
+	issuer, err := oidctest.NewIssuerWithAlgorithm(common.ES256)
+	require.NoError(t, err)
+	t.Cleanup(issuer.Close)
+
+	provider, err := oidc.NewProvider(ctx, issuer.URL(), nil)
+	require.NoError(t, err)
+	verifier := provider.Verifier(oidc.Config{ClientID: oidcClientID, SupportedAlgorithms: []common.AlgorithmType{common.ES256}})
+
+	atHash, err := oidc.TokenHash(common.ES256, "access-token")
+	require.NoError(t, err)
+	rs256Hash, err := oidc.TokenHash(common.RS256, "access-token")
+	require.NoError(t, err)
+	assert.Equal(t, rs256Hash, atHash, "ES256 and RS256 both use SHA-256")
+
+	claims := issuer.Claims(oidcClientID, "user-1")
+	claims[oidc.AccessTokenHash] = atHash
+	rawIDToken, err := issuer.Sign(claims)
+	require.NoError(t, err)
+
+	_, err = verifier.Verify(ctx, rawIDToken, oidc.WithAccessToken("access-token"))
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, rawIDToken, oidc.WithAccessToken("other-access-token"))
+	assert.Error(t, err)
+}
+
+func TestOidcTokenHashSizes(t *testing.T) {
+	for alg, length := range map[common.AlgorithmType]int{"RS256": 22, "ES384": 32, "PS512": 43} {
+		hash, err := oidc.TokenHash(alg, "access-token")
+		require.NoError(t, err, alg)
+		assert.Len(t, hash, length, alg)
+	}
+
+	for _, alg := range []common.AlgorithmType{common.None, common.RSA_OAEP, "RS1024", "XS256"} {
+		_, err := oidc.TokenHash(alg, "access-token")
+		assert.Error(t, err, alg)
+	}
+}
+
+func TestOidcRequiresRequestedHashClaims(t *testing.T) {
+	ctx := context.Background()
+	issuer, verifier := newOidcVerifier(t, oidc.Config{})
+
+	rawIDToken, err := issuer.Sign(issuer.Claims(oidcClientID, "user-1"))
+	require.NoError(t, err)
+
+	_, err = verifier.Verify(ctx, rawIDToken)
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, rawIDToken, oidc.WithAccessToken("access-token"))
+	assert.ErrorContains(t, err, oidc.AccessTokenHash)
+	_, err = verifier.Verify(ctx, rawIDToken, oidc.WithCode("auth-code"))
+	assert.ErrorContains(t, err, oidc.CodeHash)
+}
+
+func TestOidcProviderRejectsMultiTenantIssuerOnAnotherHost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(oidc.Discovery{
+			Issuer:  "https://login.evil.example.com/{tenantid}/v2.0",
+			JwksURI: "https://login.evil.example.com/keys",
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	_, err := oidc.NewProvider(context.Background(), server.URL, nil)
+	assert.ErrorContains(t, err, "does not match")
+}
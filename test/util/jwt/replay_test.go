@@ -0,0 +1,115 @@
+package jwt
+
+import (
+	"context"
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSingleUseTokenRejectedOnReplay(t *testing.T) {
+	key := []byte("TEST")
+	cache := jwt.NewMemoryReplayCache(10)
+
+	claims := common.NewClaimSet()
+	_ = claims.Add(string(common.ExpirationTime), time.Now().Add(15*time.Minute).Format(time.RFC3339))
+	tokenString, err := jwt.NewJWSToken(common.HS256, key).AddClaims(claims).SingleUse().Serialize()
+	require.NoError(t, err)
+
+	first, err := jwt.DecodeToken(tokenString, key)
+	require.NoError(t, err)
+	_, err = first.WithReplayCache(cache).Validate()
+	require.NoError(t, err)
+
+	second, err := jwt.DecodeToken(tokenString, key)
+	require.NoError(t, err)
+	_, err = second.WithReplayCache(cache).Validate()
+	assert.EqualError(t, err, "token has already been used")
+}
+
+func TestReusableTokenIgnoresReplayCache(t *testing.T) {
+	key := []byte("TEST")
+	cache := jwt.NewMemoryReplayCache(10)
+
+	tokenString, err := jwt.NewJWSToken(common.HS256, key).AddClaims(common.NewClaimSet()).Serialize()
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		tokenBuilder, err := jwt.DecodeToken(tokenString, key)
+		require.NoError(t, err)
+		_, err = tokenBuilder.WithReplayCache(cache).Validate()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestMemoryReplayCacheIsBounded(t *testing.T) {
+	ctx := context.Background()
+	cache := jwt.NewMemoryReplayCache(2)
+
+	ok, err := cache.MarkUsed(ctx, "a", time.Now().Add(20*time.Millisecond))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, _ = cache.MarkUsed(ctx, "b", time.Now().Add(time.Hour))
+	assert.True(t, ok)
+
+	_, err = cache.MarkUsed(ctx, "c", time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, jwt.ErrReplayCacheFull)
+
+	time.Sleep(30 * time.Millisecond)
+
+	ok, err = cache.MarkUsed(ctx, "c", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestSingleUseTokenRejectedWithoutReplayCache(t *testing.T) {
+	key := []byte("TEST")
+
+	claims := common.NewClaimSet()
+	_ = claims.Add(string(common.ExpirationTime), time.Now().Add(15*time.Minute).Format(time.RFC3339))
+	tokenString, err := jwt.NewJWSToken(common.HS256, key).AddClaims(claims).SingleUse().Serialize()
+	require.NoError(t, err)
+
+	tokenBuilder, err := jwt.DecodeToken(tokenString, key)
+	require.NoError(t, err)
+	_, err = tokenBuilder.Validate()
+	assert.Error(t, err)
+}
+
+func TestMemoryReplayCacheUnbounded(t *testing.T) {
+	cache := jwt.NewMemoryReplayCache(0)
+	expiresAt := time.Now().Add(time.Minute)
+
+	for _, jti := range []string{"a", "b", "c"} {
+		firstUse, err := cache.MarkUsed(context.Background(), jti, expiresAt)
+		require.NoError(t, err)
+		assert.True(t, firstUse)
+	}
+	assert.Equal(t, 3, cache.Len())
+}
+
+func TestMemoryReplayCacheUnboundedEvictsExpired(t *testing.T) {
+	ctx := context.Background()
+	cache := jwt.NewMemoryReplayCache(0)
+	expired := time.Now().Add(-time.Second)
+
+	for i := 0; i < 1000; i++ {
+		firstUse, err := cache.MarkUsed(ctx, fmt.Sprintf("expired-%d", i), expired)
+		require.NoError(t, err)
+		assert.True(t, firstUse)
+	}
+	assert.Less(t, cache.Len(), 100, "expired entries should be swept without a cap")
+
+	firstUse, err := cache.MarkUsed(ctx, "live", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, firstUse)
+	firstUse, err = cache.MarkUsed(ctx, "live", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, firstUse)
+}
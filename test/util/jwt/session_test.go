@@ -0,0 +1,133 @@
+package jwt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestSessionIssueAndRotate(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("TEST")
+	service, err := session.NewService(session.Config{SigningAlgorithm: common.HS256, SigningKey: key})
+	require.NoError(t, err)
+
+	pair, err := service.Issue(ctx, common.ClaimSet{string(common.Subject): "user-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", pair.TokenType)
+
+	tokenBuilder, err := jwt.DecodeToken(pair.AccessToken, key)
+	require.NoError(t, err)
+	_, err = tokenBuilder.Validate()
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", tokenBuilder.GetClaims()[string(common.Subject)])
+
+	rotated, err := service.Refresh(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, pair.RefreshToken, rotated.RefreshToken)
+
+	_, err = service.Refresh(ctx, "not-a-refresh-token")
+	assert.ErrorIs(t, err, session.ErrRefreshTokenInvalid)
+}
+
+func TestSessionReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	service, err := session.NewService(session.Config{SigningAlgorithm: common.HS256, SigningKey: []byte("TEST")})
+	require.NoError(t, err)
+
+	pair, err := service.Issue(ctx, common.ClaimSet{string(common.Subject): "user-1"})
+	require.NoError(t, err)
+
+	rotated, err := service.Refresh(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+
+	_, err = service.Refresh(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, session.ErrRefreshTokenReused)
+
+	_, err = service.Refresh(ctx, rotated.RefreshToken)
+	assert.ErrorIs(t, err, session.ErrRefreshTokenRevoked)
+}
+
+func TestSessionJweRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	publicKey, _ := os.ReadFile("./rsa_public_key.pem")
+	privateKey, _ := os.ReadFile("./rsa_private_key.pem")
+
+	service, err := session.NewService(session.Config{
+		SigningAlgorithm:     common.HS256,
+		SigningKey:           []byte("TEST"),
+		RefreshTokenFormat:   session.JWE,
+		RefreshEncryptionKey: publicKey,
+		RefreshDecryptionKey: privateKey,
+	})
+	require.NoError(t, err)
+
+	pair, err := service.Issue(ctx, common.ClaimSet{string(common.Subject): "user-1"})
+	require.NoError(t, err)
+
+	_, err = service.Refresh(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+
+	require.NoError(t, service.Revoke(ctx, pair.RefreshToken))
+	_, err = service.Refresh(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, session.ErrRefreshTokenRevoked)
+}
+
+func TestSessionRejectsUnsupportedAlgorithms(t *testing.T) {
+	for _, algorithm := range []common.AlgorithmType{"", common.None, common.RSA_OAEP, "HS512"} {
+		_, err := session.NewService(session.Config{SigningAlgorithm: algorithm, SigningKey: []byte("TEST")})
+		assert.Error(t, err, algorithm)
+	}
+}
+
+func TestSessionRejectsForgedJweRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	publicKey, _ := os.ReadFile("./rsa_public_key.pem")
+	privateKey, _ := os.ReadFile("./rsa_private_key.pem")
+	service, err := session.NewService(session.Config{
+		SigningAlgorithm:     common.HS256,
+		SigningKey:           []byte("TEST"),
+		RefreshTokenFormat:   session.JWE,
+		RefreshEncryptionKey: publicKey,
+		RefreshDecryptionKey: privateKey,
+	})
+	require.NoError(t, err)
+
+	pair, err := service.Issue(ctx, common.ClaimSet{string(common.Subject): "user-1"})
+	require.NoError(t, err)
+
+	tokenBuilder, err := jwt.DecodeToken(pair.RefreshToken, privateKey)
+	require.NoError(t, err)
+	_, err = tokenBuilder.Validate()
+	require.NoError(t, err)
+	claims := tokenBuilder.GetClaims()
+	assert.NotEqual(t, claims[session.SecretClaim], claims[string(common.JwtID)])
+
+	// An unsigned JWS carrying the genuine claims.
+	header, _ := json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+	_, err = service.Refresh(ctx, unsigned)
+	assert.ErrorIs(t, err, session.ErrRefreshTokenInvalid)
+
+	// A JWE minted with the public key, knowing the jti and family but not the secret.
+	forged, err := jwt.NewJWEToken(common.AlgorithmSuite{AlgorithmType: common.RSA_OAEP, AuthAlgorithmType: common.A256GCM}, publicKey).
+		AddClaims(common.ClaimSet{
+			string(common.JwtID): claims[string(common.JwtID)],
+			session.FamilyClaim:  claims[session.FamilyClaim],
+			session.SecretClaim:  "guessed",
+		}).Serialize()
+	require.NoError(t, err)
+	_, err = service.Refresh(ctx, forged)
+	assert.ErrorIs(t, err, session.ErrRefreshTokenInvalid)
+
+	_, err = service.Refresh(ctx, pair.RefreshToken)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,151 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/jws"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+// countingSigner wraps a crypto.Signer, standing in for an external key such as an HSM or ssh-agent key.
+type countingSigner struct {
+	crypto.Signer
+	signs int
+}
+
+func (s *countingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.signs++
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestSignerRS256VerifiesWithPem(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer := &countingSigner{Signer: privateKey}
+
+	claims := common.NewClaimSet()
+	require.NoError(t, claims.Add(string(common.Subject), "user"))
+	tokenBytes, err := jwt.NewJWSTokenWithSigner(common.RS256, signer).AddClaims(claims).Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, 1, signer.signs)
+
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	tokenBuilder, err := jwt.DecodeToken(string(tokenBytes), keyPem)
+	require.NoError(t, err)
+	valid, err := tokenBuilder.Validate()
+	require.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestSignerES256WithPkcs8Pem(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	tokenBytes, err := jwt.NewJWSToken(common.ES256, keyPem).AddClaims(common.NewClaimSet()).Serialize()
+	require.NoError(t, err)
+
+	tokenBuilder, err := jwt.DecodeToken(string(tokenBytes), nil)
+	require.NoError(t, err)
+	valid, err := tokenBuilder.WithSigner(privateKey).Validate()
+	require.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestES256RequiresP256Keys(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	_, err = jwt.NewJWSTokenWithSigner(common.ES256, privateKey).AddClaims(common.NewClaimSet()).Serialize()
+	assert.ErrorContains(t, err, "P-256")
+
+	err = jws.VerifySignature(common.ES256, []byte("header.payload"), make([]byte, 64), &privateKey.PublicKey)
+	assert.ErrorContains(t, err, "P-256")
+}
+
+func TestSignerRejectsMismatchedAlgorithm(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	_, err = jwt.NewJWSTokenWithSigner(common.RS256, privateKey).AddClaims(common.NewClaimSet()).Serialize()
+	assert.Error(t, err)
+
+	assert.Nil(t, jwt.NewJWSTokenWithSigner(common.RS256, nil))
+}
+
+func TestDecrypterRoundTrip(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	suite := common.AlgorithmSuite{
+		AlgorithmType:     common.RSA_OAEP,
+		AuthAlgorithmType: common.A256GCM,
+	}
+
+	claims := common.NewClaimSet()
+	require.NoError(t, claims.Add(string(common.Audience), "developers"))
+	tokenBytes, err := jwt.NewJWETokenWithDecrypter(suite, privateKey).AddClaims(claims).Serialize()
+	require.NoError(t, err)
+
+	tokenBuilder, err := jwt.DecodeToken(string(tokenBytes), nil)
+	require.NoError(t, err)
+	valid, err := tokenBuilder.WithDecrypter(privateKey).Validate()
+	require.NoError(t, err)
+	assert.True(t, valid)
+	assert.Equal(t, "developers", tokenBuilder.GetClaims()[string(common.Audience)])
+}
+
+func TestSessionServiceWithSigner(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := &countingSigner{Signer: privateKey}
+
+	service, err := session.NewService(session.Config{
+		SigningAlgorithm: common.ES256,
+		Signer:           signer,
+	})
+	require.NoError(t, err)
+
+	pair, err := service.Issue(context.Background(), common.ClaimSet{string(common.Subject): "user"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, signer.signs)
+
+	tokenBuilder, err := jwt.DecodeToken(pair.AccessToken, nil)
+	require.NoError(t, err)
+	valid, err := tokenBuilder.WithSigner(privateKey).Validate()
+	require.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestSessionServiceRejectsMismatchedSigner(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for _, config := range []session.Config{
+		{Signer: ecKey},
+		{SigningAlgorithm: common.HS256, Signer: ecKey},
+		{SigningAlgorithm: common.RS256, Signer: ecKey},
+		{SigningAlgorithm: common.ES256, Signer: rsaKey},
+	} {
+		_, err := session.NewService(config)
+		assert.Error(t, err, config.SigningAlgorithm)
+	}
+
+	_, err = session.NewService(session.Config{SigningAlgorithm: common.RS256, Signer: rsaKey})
+	assert.NoError(t, err)
+}
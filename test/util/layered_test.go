@@ -0,0 +1,108 @@
+package util_test
+
+import (
+	"errors"
+	"github.com/bmwadforth-com/armor-go/src/helpers/gcp/gcptest"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/sethvargo/go-envconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type LayeredConfig struct {
+	Host     string        `json:"host" env:"APP_HOST" default:"localhost"`
+	Port     int           `json:"port" env:"APP_PORT" default:"8080" flag:"port" usage:"listen port"`
+	Debug    bool          `json:"debug" flag:"debug"`
+	Timeout  time.Duration `env:"APP_TIMEOUT" default:"5s"`
+	Tags     []string      `json:"tags" env:"APP_TAGS"`
+	Database struct {
+		Name     string `json:"name" env:"DB_NAME"`
+		Password string `json:"password" secret:"projects/test/secrets/db-password/versions/latest"`
+	} `json:"database"`
+}
+
+func (c *LayeredConfig) Validate() error {
+	if c.Database.Name == "" {
+		return errors.New("database name is required")
+	}
+	return nil
+}
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadLayeredConfigurationPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"host": "file-host", "port": 9000, "tags": ["a"], "database": {"name": "file-db"}}`)
+
+	secrets := gcptest.NewSecretManager()
+	secrets.AddVersion("projects/test/secrets/db-password", "s3cret")
+
+	var config LayeredConfig
+	report, err := util.LoadLayeredConfiguration(&config, util.LayeredOptions{
+		Secrets: secrets,
+		Files:   []string{path},
+		Env:     envconfig.MapLookuper(map[string]string{"APP_HOST": "env-host", "DB_NAME": "env-db"}),
+		Args:    []string{"-port", "9090"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "env-host", config.Host)
+	assert.Equal(t, 9090, config.Port)
+	assert.Equal(t, 5*time.Second, config.Timeout)
+	assert.Equal(t, []string{"a"}, config.Tags)
+	assert.Equal(t, "env-db", config.Database.Name)
+	assert.Equal(t, "s3cret", config.Database.Password)
+	assert.False(t, config.Debug)
+
+	assert.Equal(t, util.ConfigReport{
+		"Host":              util.SourceEnv,
+		"Port":              util.SourceFlag,
+		"Debug":             util.SourceUnset,
+		"Timeout":           util.SourceDefault,
+		"Tags":              util.SourceFile,
+		"Database.Name":     util.SourceEnv,
+		"Database.Password": util.SourceSecret,
+	}, report)
+	assert.Contains(t, report.String(), "Database.Name=env\n")
+}
+
+func TestLoadLayeredConfigurationDefaultsOnly(t *testing.T) {
+	var config LayeredConfig
+	config.Database.Name = "preset"
+	report, err := util.LoadLayeredConfiguration(&config, util.LayeredOptions{
+		Env: envconfig.MapLookuper(map[string]string{}),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "localhost", config.Host)
+	assert.Equal(t, 8080, config.Port)
+	assert.Equal(t, util.SourceDefault, report["Host"])
+	assert.Equal(t, util.SourceUnset, report["Database.Name"])
+}
+
+func TestLoadLayeredConfigurationErrors(t *testing.T) {
+	var config LayeredConfig
+	_, err := util.LoadLayeredConfiguration(&config, util.LayeredOptions{
+		Env: envconfig.MapLookuper(map[string]string{}),
+	})
+	assert.ErrorContains(t, err, "database name is required")
+
+	_, err = util.LoadLayeredConfiguration(&config, util.LayeredOptions{
+		Env:  envconfig.MapLookuper(map[string]string{"DB_NAME": "db"}),
+		Args: []string{"-port", "not-a-number"},
+	})
+	assert.ErrorContains(t, err, "failed to parse flags")
+
+	_, err = util.LoadLayeredConfiguration(&config, util.LayeredOptions{
+		Files:   []string{filepath.Join(t.TempDir(), "missing.json")},
+		SkipEnv: true,
+	})
+	assert.ErrorContains(t, err, "failed to read config file")
+}
@@ -0,0 +1,82 @@
+package util_test
+
+import (
+	"context"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+)
+
+// observeLogs replaces the global logger for the duration of the test.
+func observeLogs(t *testing.T) *observer.ObservedLogs {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger, sLogger := util.Logger, util.SLogger
+	util.Logger = zap.New(core)
+	util.SLogger = util.Logger.Sugar()
+	t.Cleanup(func() {
+		util.Logger, util.SLogger = logger, sLogger
+	})
+
+	return logs
+}
+
+func TestLogCtxAddsContextFields(t *testing.T) {
+	logs := observeLogs(t)
+
+	ctx := util.ContextWithRequestID(context.Background(), "req-1")
+	ctx = util.ContextWithSubject(ctx, "user-42")
+	ctx = util.ContextWithTraceID(ctx, "abc123")
+	ctx = util.ContextWithLogFields(ctx, zap.Int("attempt", 2))
+
+	util.LogInfoCtx(ctx, "processing order %d", 7)
+	util.LogErrorCtx(ctx, "failed")
+	util.LogCtx(context.Background(), zapcore.WarnLevel, "no fields")
+
+	entries := logs.All()
+	require.Len(t, entries, 3)
+	assert.Equal(t, "[ARMOR]: processing order 7", entries[0].Message)
+	assert.Equal(t, map[string]interface{}{
+		util.LogFieldRequestID: "req-1",
+		util.LogFieldSubject:   "user-42",
+		util.LogFieldTraceID:   "abc123",
+		"attempt":              int64(2),
+	}, entries[0].ContextMap())
+	assert.Equal(t, zapcore.ErrorLevel, entries[1].Level)
+	assert.Len(t, entries[1].Context, 4)
+	assert.Empty(t, entries[2].Context)
+}
+
+func TestContextWithLogFieldsReplacesKeys(t *testing.T) {
+	parent := util.ContextWithSubject(util.ContextWithRequestID(context.Background(), "req-1"), "anonymous")
+	child := util.ContextWithSubject(parent, "user-42")
+
+	subject, ok := util.SubjectFromContext(child)
+	assert.True(t, ok)
+	assert.Equal(t, "user-42", subject)
+	assert.Len(t, util.LogFieldsFromContext(child), 2)
+
+	// The parent context is unchanged.
+	subject, _ = util.SubjectFromContext(parent)
+	assert.Equal(t, "anonymous", subject)
+
+	requestID, ok := util.RequestIDFromContext(child)
+	assert.True(t, ok)
+	assert.Equal(t, "req-1", requestID)
+
+	_, ok = util.TraceIDFromContext(child)
+	assert.False(t, ok)
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	logs := observeLogs(t)
+
+	util.LoggerFromContext(util.ContextWithRequestID(context.Background(), "req-1")).Info("direct")
+
+	entries := logs.FilterMessage("direct").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "req-1", entries[0].ContextMap()[util.LogFieldRequestID])
+}
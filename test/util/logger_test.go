@@ -0,0 +1,105 @@
+package util_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"log/slog"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// restoreLogger restores the global logger when the test ends.
+func restoreLogger(t *testing.T) {
+	logger, sLogger, logLevel, defaultSlog := util.Logger, util.SLogger, util.LogLevel, slog.Default()
+	t.Cleanup(func() {
+		util.Logger, util.SLogger, util.LogLevel = logger, sLogger, logLevel
+		slog.SetDefault(defaultSlog)
+	})
+}
+
+func TestLogFunctionsDoNotPanicWithoutLogger(t *testing.T) {
+	restoreLogger(t)
+	ctx := util.ContextWithRequestID(context.Background(), "req-1")
+
+	for _, reset := range []func(){
+		func() { util.SetLogger(nil) },
+		func() { util.Logger, util.SLogger = nil, nil },
+	} {
+		reset()
+		assert.NotPanics(t, func() {
+			util.Log(zapcore.InfoLevel, "log")
+			util.LogInfo("info")
+			util.LogWarn("warn")
+			util.LogError("error")
+			util.Info("info", "key", "value")
+			util.ErrorCtx(ctx, "error", "key", "value")
+			util.LogInfoCtx(ctx, "info")
+			util.LoggerFromContext(ctx).Info("info")
+		})
+	}
+}
+
+// TestLogFatalWithoutLogger runs itself in a child process, which calls LogFatal before any logger is set.
+func TestLogFatalWithoutLogger(t *testing.T) {
+	if os.Getenv("ARMOR_TEST_LOG_FATAL") == "1" {
+		util.SetLogger(nil)
+		util.LogFatal("configuration is missing: %s", "jwt_key")
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLogFatalWithoutLogger$")
+	cmd.Env = append(os.Environ(), "ARMOR_TEST_LOG_FATAL=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, cmd.Run(), &exitErr)
+	assert.Equal(t, 1, exitErr.ExitCode())
+	assert.Contains(t, stderr.String(), "[ARMOR]: configuration is missing: jwt_key")
+}
+
+func TestSetLogger(t *testing.T) {
+	restoreLogger(t)
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	util.SetLogger(zap.New(core))
+	util.LogInfo("injected")
+	util.Info("structured")
+
+	assert.Equal(t, 1, logs.FilterMessage("[ARMOR]: injected").Len())
+	assert.Equal(t, 1, logs.FilterMessage("[ARMOR]: structured").Len())
+}
+
+func TestInitLoggerCleanupReturnsNilOnStdout(t *testing.T) {
+	restoreLogger(t)
+
+	cleanup := util.InitLogger(true, zapcore.InfoLevel)
+	util.LogInfo("flushed")
+	assert.NoError(t, cleanup())
+}
+
+type failingSyncer struct{}
+
+func (failingSyncer) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (failingSyncer) Sync() error {
+	return errors.New("disk full")
+}
+
+func TestSyncLoggerReturnsErrors(t *testing.T) {
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), failingSyncer{}, zapcore.InfoLevel))
+
+	err := util.SyncLogger(logger)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "failed to flush log buffer: disk full")
+}
@@ -0,0 +1,84 @@
+package util_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"testing"
+)
+
+type RedactConfig struct {
+	DbConnString string `json:"db_conn_string" secret:"projects/test/secrets/db/versions/latest"`
+	Keys         struct {
+		ApiKey            util.Secret `json:"api_key"`
+		SigningKey        string      `json:"signing_key" secret:"true"`
+		Unused            string      `json:"unused" secret:"true"`
+		JwePublicKeyPath  string      `json:"jwe_public_key_path"`
+		JwePrivateKeyPath string      `json:"-"`
+	} `json:"keys"`
+	Tokens map[string]util.Secret
+}
+
+func (c *RedactConfig) Validate() error {
+	return nil
+}
+
+func TestRedactConfiguration(t *testing.T) {
+	var config RedactConfig
+	config.DbConnString = "postgres://user:password@db"
+	config.Keys.ApiKey = "api-key"
+	config.Keys.SigningKey = "signing-key"
+	config.Keys.JwePublicKeyPath = "/keys/public.pem"
+	config.Keys.JwePrivateKeyPath = "/keys/private.pem"
+	config.Tokens = map[string]util.Secret{"github": "ghp_token"}
+
+	dump := util.RedactConfiguration(&config)
+	for _, secret := range []string{"password", "api-key", "signing-key", "ghp_token", "private.pem"} {
+		assert.NotContains(t, dump, secret)
+	}
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(dump), &decoded))
+	keys := decoded["keys"].(map[string]interface{})
+	assert.Equal(t, util.Redacted, decoded["db_conn_string"])
+	assert.Equal(t, util.Redacted, keys["api_key"])
+	assert.Equal(t, util.Redacted, keys["signing_key"])
+	assert.Equal(t, "", keys["unused"])
+	assert.Equal(t, "/keys/public.pem", keys["jwe_public_key_path"])
+	assert.Equal(t, util.Redacted, decoded["Tokens"].(map[string]interface{})["github"])
+}
+
+func TestSecretIsNeverFormatted(t *testing.T) {
+	secret := util.Secret("api-key")
+
+	assert.Equal(t, "api-key", secret.Reveal())
+	for _, verb := range []string{"%v", "%s", "%q", "%x", "%#v", "%+v"} {
+		assert.Equal(t, util.Redacted, fmt.Sprintf(verb, secret), verb)
+	}
+
+	_, err := util.SerializeJson(struct{ Key util.Secret }{Key: secret})
+	assert.ErrorIs(t, err, util.ErrSecretNotSerializable)
+
+	var config RedactConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"keys": {"api_key": "from-file"}}`), &config))
+	assert.Equal(t, "from-file", config.Keys.ApiKey.Reveal())
+}
+
+func TestSecretIsNeverLoggedByZap(t *testing.T) {
+	var buf bytes.Buffer
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zapcore.DebugLevel)
+	logger := zap.New(core)
+
+	secret := util.Secret("api-key")
+	logger.Info("secret", zap.Any("key", secret), zap.Any("config", struct{ Key util.Secret }{Key: secret}))
+	logger.Sugar().Infof("key %v", secret)
+	require.NoError(t, logger.Sync())
+
+	assert.NotContains(t, buf.String(), "api-key")
+	assert.Contains(t, buf.String(), util.Redacted)
+}
@@ -0,0 +1,186 @@
+package util_test
+
+import (
+	"context"
+	"errors"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type ReloadConfig struct {
+	JwtKey    string `json:"jwt_key"`
+	Threshold int    `json:"threshold"`
+}
+
+func (c *ReloadConfig) Validate() error {
+	if c.JwtKey == "" {
+		return errors.New("jwt_key is required")
+	}
+	return nil
+}
+
+func TestConfigWatcherReloadsChangedFile(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"jwt_key": "key-1", "threshold": 1}`)
+
+	var failures atomic.Int32
+	watcher, err := util.WatchConfiguration(context.Background(), util.FileConfigLoader[ReloadConfig](path), util.WatchOptions{
+		Interval: 10 * time.Millisecond,
+		Files:    []string{path},
+		OnError:  func(err error) { failures.Add(1) },
+	})
+	require.NoError(t, err)
+	defer watcher.Close()
+	assert.Equal(t, "key-1", watcher.Current().JwtKey)
+
+	changes, stop := watcher.Changes()
+	defer stop()
+	var notified atomic.Pointer[ReloadConfig]
+	watcher.Subscribe(func(previous *ReloadConfig, current *ReloadConfig) {
+		assert.Equal(t, "key-1", previous.JwtKey)
+		notified.Store(current)
+	})
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"jwt_key": "key-2", "threshold": 2}`), 0600))
+
+	select {
+	case config := <-changes:
+		assert.Equal(t, "key-2", config.JwtKey)
+		assert.Equal(t, 2, config.Threshold)
+	case <-time.After(5 * time.Second):
+		t.Fatal("configuration was not reloaded")
+	}
+	assert.Equal(t, "key-2", watcher.Current().JwtKey)
+	assert.Equal(t, "key-2", notified.Load().JwtKey)
+
+	// An invalid configuration is reported and not swapped in.
+	require.NoError(t, os.WriteFile(path, []byte(`{"jwt_key": ""}`), 0600))
+	assert.Eventually(t, func() bool { return failures.Load() > 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "key-2", watcher.Current().JwtKey)
+}
+
+func TestConfigWatcherRetriesFailedFileReload(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"jwt_key": "key-1"}`)
+
+	var failing atomic.Bool
+	var failures atomic.Int32
+	loadFile := util.FileConfigLoader[ReloadConfig](path)
+	load := func(ctx context.Context) (*ReloadConfig, error) {
+		if failing.Load() {
+			return nil, errors.New("file is incomplete")
+		}
+		return loadFile(ctx)
+	}
+
+	watcher, err := util.WatchConfiguration(context.Background(), load, util.WatchOptions{
+		Interval: 10 * time.Millisecond,
+		Files:    []string{path},
+		OnError:  func(err error) { failures.Add(1) },
+	})
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	failing.Store(true)
+	require.NoError(t, os.WriteFile(path, []byte(`{"jwt_key": "key-2"}`), 0600))
+	assert.Eventually(t, func() bool { return failures.Load() > 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "key-1", watcher.Current().JwtKey)
+
+	// The file is unchanged from here on, but the failed reload is retried.
+	failing.Store(false)
+	assert.Eventually(t, func() bool { return watcher.Current().JwtKey == "key-2" }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestConfigWatcherReload(t *testing.T) {
+	var version atomic.Int32
+	version.Store(1)
+	load := func(ctx context.Context) (*ReloadConfig, error) {
+		if version.Load() < 0 {
+			return nil, errors.New("source unavailable")
+		}
+		return &ReloadConfig{JwtKey: "key", Threshold: int(version.Load())}, nil
+	}
+
+	watcher, err := util.WatchConfiguration(context.Background(), load, util.WatchOptions{Interval: time.Hour})
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	var calls int
+	watcher.Subscribe(func(_ *ReloadConfig, _ *ReloadConfig) { calls++ })
+
+	require.NoError(t, watcher.Reload(context.Background()))
+	assert.Equal(t, 0, calls, "unchanged configuration should not notify subscribers")
+
+	version.Store(2)
+	require.NoError(t, watcher.Reload(context.Background()))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 2, watcher.Current().Threshold)
+
+	version.Store(-1)
+	assert.ErrorContains(t, watcher.Reload(context.Background()), "source unavailable")
+	assert.Equal(t, 2, watcher.Current().Threshold)
+}
+
+func TestConfigWatcherChangesStop(t *testing.T) {
+	var version atomic.Int32
+	load := func(ctx context.Context) (*ReloadConfig, error) {
+		return &ReloadConfig{JwtKey: "key", Threshold: int(version.Add(1))}, nil
+	}
+
+	watcher, err := util.WatchConfiguration(context.Background(), load, util.WatchOptions{Interval: time.Hour})
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	changes, stop := watcher.Changes()
+	require.NoError(t, watcher.Reload(context.Background()))
+	assert.Equal(t, 2, (<-changes).Threshold)
+
+	stop()
+	stop()
+	require.NoError(t, watcher.Reload(context.Background()))
+	_, open := <-changes
+	assert.False(t, open, "the channel should be closed without further deliveries")
+}
+
+func TestConfigWatcherConcurrentReloadsKeepNewest(t *testing.T) {
+	var calls atomic.Int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	load := func(ctx context.Context) (*ReloadConfig, error) {
+		n := calls.Add(1)
+		if n == 2 {
+			close(entered)
+			<-release
+		}
+		return &ReloadConfig{JwtKey: "key", Threshold: int(n)}, nil
+	}
+
+	watcher, err := util.WatchConfiguration(context.Background(), load, util.WatchOptions{Interval: time.Hour})
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	stale := make(chan error, 1)
+	go func() { stale <- watcher.Reload(context.Background()) }()
+	<-entered
+
+	newer := make(chan error, 1)
+	go func() { newer <- watcher.Reload(context.Background()) }()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(2), calls.Load(), "a reload should not load while another is in progress")
+
+	close(release)
+	require.NoError(t, <-stale)
+	require.NoError(t, <-newer)
+	assert.Equal(t, 3, watcher.Current().Threshold)
+}
+
+func TestWatchConfigurationRejectsInvalidInitialConfig(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "threshold: 1\n")
+
+	_, err := util.WatchConfiguration(context.Background(), util.FileConfigLoader[ReloadConfig](path), util.WatchOptions{})
+	assert.ErrorContains(t, err, "jwt_key is required")
+}
@@ -0,0 +1,46 @@
+package util_test
+
+import (
+	"context"
+	"github.com/bmwadforth-com/armor-go/src/helpers/gcp/gcptest"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type SecretConfig struct {
+	DbPassword string `json:"db_password" secret:"projects/test/secrets/db-password/versions/latest"`
+	Keys       struct {
+		JwtKey []byte `json:"jwt_key" secret:"projects/test/secrets/jwt-key/versions/1"`
+		ApiKey string `json:"api_key" secret:"true"`
+	} `json:"keys"`
+}
+
+func (c *SecretConfig) Validate() error {
+	return nil
+}
+
+func TestLoadSecrets(t *testing.T) {
+	secrets := gcptest.NewSecretManager()
+	secrets.AddVersion("projects/test/secrets/db-password", "old-password")
+	secrets.AddVersion("projects/test/secrets/db-password", "new-password")
+	secrets.AddVersion("projects/test/secrets/jwt-key", "signing-key")
+
+	var config SecretConfig
+	config.Keys.ApiKey = "unchanged"
+	err := util.LoadSecrets(context.Background(), &config, secrets)
+	require.NoError(t, err)
+
+	assert.Equal(t, "new-password", config.DbPassword)
+	assert.Equal(t, []byte("signing-key"), config.Keys.JwtKey)
+	assert.Equal(t, "unchanged", config.Keys.ApiKey)
+}
+
+func TestLoadSecretsReportsEveryMissingSecret(t *testing.T) {
+	var config SecretConfig
+	err := util.LoadSecrets(context.Background(), &config, gcptest.NewSecretManager())
+
+	assert.ErrorContains(t, err, "DbPassword")
+	assert.ErrorContains(t, err, "JwtKey")
+}
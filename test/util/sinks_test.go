@@ -0,0 +1,186 @@
+package util_test
+
+import (
+	"encoding/json"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readLogFile(t *testing.T, path string) []map[string]interface{} {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "app.log")
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	logger := util.NewLoggerWithOptions(util.LoggerOptions{
+		Level: level,
+		File:  &util.FileSinkOptions{Path: path, MaxSizeMB: 1, MaxBackups: 2},
+	})
+
+	logger.Debug("hidden")
+	logger.Info("written", zap.String("order", "1"))
+	level.SetLevel(zapcore.DebugLevel)
+	logger.Debug("now visible")
+
+	entries := readLogFile(t, path)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "written", entries[0]["message"])
+	assert.Equal(t, "INFO", entries[0]["severity"])
+	assert.Equal(t, "1", entries[0]["order"])
+	assert.Contains(t, entries[0], util.CloudSourceLocationKey)
+	assert.Equal(t, "now visible", entries[1]["message"])
+}
+
+func TestSampling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	logger := util.NewLoggerWithOptions(util.LoggerOptions{
+		MinimumLevel: zapcore.InfoLevel,
+		File:         &util.FileSinkOptions{Path: path},
+		Sampling:     &util.SamplingOptions{Tick: time.Minute, First: 3, Thereafter: 5},
+	})
+
+	for i := 0; i < 20; i++ {
+		logger.Info("hot path")
+	}
+	logger.Info("cold path")
+
+	// The first 3, then the 8th, 13th and 18th.
+	entries := readLogFile(t, path)
+	assert.Len(t, entries, 7)
+	assert.Equal(t, "cold path", entries[6]["message"])
+}
+
+func TestErrorsToStderr(t *testing.T) {
+	stdout, stderr := os.Stdout, os.Stderr
+	outR, outW, err := os.Pipe()
+	require.NoError(t, err)
+	errR, errW, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stdout, os.Stderr = outW, errW
+
+	logger := util.NewLoggerWithOptions(util.LoggerOptions{
+		IsRelease:      true,
+		MinimumLevel:   zapcore.InfoLevel,
+		ErrorsToStderr: true,
+	})
+	os.Stdout, os.Stderr = stdout, stderr
+
+	logger.Info("to stdout")
+	logger.Error("to stderr")
+	require.NoError(t, outW.Close())
+	require.NoError(t, errW.Close())
+
+	out, err := io.ReadAll(outR)
+	require.NoError(t, err)
+	errOut, err := io.ReadAll(errR)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(out), "to stdout")
+	assert.NotContains(t, string(out), "to stderr")
+	assert.Contains(t, string(errOut), "to stderr")
+	assert.NotContains(t, string(errOut), "to stdout")
+}
+
+func serveLevel(t *testing.T, handler http.Handler, method string, body string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(method, "/log/level", strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	return rec.Code, response
+}
+
+func TestLevelHandler(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	handler := util.NewLevelHandler(level)
+
+	status, response := serveLevel(t, handler, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]interface{}{"level": "info"}, response)
+
+	status, response = serveLevel(t, handler, http.MethodPut, `{"level": "warn"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "warn", response["level"])
+	assert.Equal(t, zapcore.WarnLevel, level.Level())
+
+	// Form values work too.
+	req := httptest.NewRequest(http.MethodPost, "/log/level?level=error", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, zapcore.ErrorLevel, level.Level())
+
+	for _, body := range []string{`{"level": "loud"}`, `{}`, `{"level": "debug", "duration": "-1m"}`, `not json`} {
+		status, response = serveLevel(t, handler, http.MethodPut, body)
+		assert.Equal(t, http.StatusBadRequest, status, body)
+		assert.NotEmpty(t, response["error"])
+	}
+	assert.Equal(t, zapcore.ErrorLevel, level.Level())
+
+	status, _ = serveLevel(t, handler, http.MethodDelete, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+}
+
+func TestLevelHandlerTemporaryChange(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	handler := util.NewLevelHandler(level)
+
+	_, response := serveLevel(t, handler, http.MethodPut, `{"level": "debug", "duration": "50ms"}`)
+	assert.Equal(t, "debug", response["level"])
+	assert.NotEmpty(t, response["revert_at"])
+
+	// A second temporary change still restores the level in place before the first.
+	handler.SetLevel(zapcore.WarnLevel, 100*time.Millisecond)
+	assert.Equal(t, zapcore.WarnLevel, level.Level())
+
+	assert.Eventually(t, func() bool {
+		return level.Level() == zapcore.InfoLevel
+	}, time.Second, 10*time.Millisecond)
+
+	_, response = serveLevel(t, handler, http.MethodGet, "")
+	assert.Equal(t, map[string]interface{}{"level": "info"}, response)
+
+	// A permanent change cancels a pending restore.
+	handler.SetLevel(zapcore.DebugLevel, 50*time.Millisecond)
+	handler.SetLevel(zapcore.ErrorLevel, 0)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, zapcore.ErrorLevel, level.Level())
+}
+
+func TestInitLoggerWithOptionsSharesLevel(t *testing.T) {
+	restoreLogger(t)
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	util.InitLoggerWithOptions(util.LoggerOptions{MinimumLevel: zapcore.WarnLevel, File: &util.FileSinkOptions{Path: path}})
+	util.LogInfo("hidden")
+	util.LogLevel.SetLevel(zapcore.InfoLevel)
+	util.LogInfo("visible")
+
+	entries := readLogFile(t, path)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "[ARMOR]: visible", entries[0]["message"])
+	assert.True(t, strings.HasSuffix(entries[0][util.CloudSourceLocationKey].(map[string]interface{})["file"].(string), "sinks_test.go"))
+}
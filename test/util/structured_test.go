@@ -0,0 +1,89 @@
+package util_test
+
+import (
+	"context"
+	"errors"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestLogDoesNotFormatArgumentsTwice(t *testing.T) {
+	logs := observeLogs(t)
+
+	util.LogInfo("discount: %s", "100%d off")
+	util.LogInfoCtx(context.Background(), "discount: %s", "50%s off")
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "[ARMOR]: discount: 100%d off", entries[0].Message)
+	assert.Equal(t, "[ARMOR]: discount: 50%s off", entries[1].Message)
+}
+
+func TestKeyValueLogging(t *testing.T) {
+	logs := observeLogs(t)
+
+	util.Debug("cache miss", "key", "orders:1")
+	util.Info("user signed in", "user", "user-42", "attempts", 2)
+	util.Warn("100% of quota used", zap.String("quota", "requests"))
+	util.Error("payment failed", zap.Error(errors.New("card declined")))
+	util.InfoCtx(util.ContextWithRequestID(context.Background(), "req-1"), "with context", "user", "user-42")
+
+	entries := logs.All()
+	require.Len(t, entries, 5)
+	assert.Equal(t, zapcore.DebugLevel, entries[0].Level)
+	assert.Equal(t, "[ARMOR]: user signed in", entries[1].Message)
+	assert.Equal(t, map[string]interface{}{"user": "user-42", "attempts": int64(2)}, entries[1].ContextMap())
+	assert.Equal(t, "[ARMOR]: 100% of quota used", entries[2].Message)
+	assert.Equal(t, "requests", entries[2].ContextMap()["quota"])
+	assert.Equal(t, "card declined", entries[3].ContextMap()["error"])
+	assert.Equal(t, map[string]interface{}{util.LogFieldRequestID: "req-1", "user": "user-42"}, entries[4].ContextMap())
+}
+
+func TestSlogHandler(t *testing.T) {
+	logs := observeLogs(t)
+	logger := slog.New(util.NewSlogHandler(util.Logger))
+
+	ctx := util.ContextWithRequestID(context.Background(), "req-1")
+	logger.With("component", "billing").WithGroup("invoice").InfoContext(ctx, "issued",
+		"id", 7, "total", 12.5, "due", time.Hour, slog.Group("customer", "name", "Ada"))
+	logger.Warn("retrying", "error", errors.New("timeout"))
+	logger.Log(context.Background(), slog.LevelInfo+2, "between levels")
+	logger.Debug("debug", slog.Group("empty"))
+
+	entries := logs.All()
+	require.Len(t, entries, 4)
+
+	assert.Equal(t, "issued", entries[0].Message)
+	assert.Equal(t, zapcore.InfoLevel, entries[0].Level)
+	assert.Equal(t, map[string]interface{}{
+		util.LogFieldRequestID: "req-1",
+		"component":            "billing",
+		"invoice": map[string]interface{}{
+			"id":       int64(7),
+			"total":    12.5,
+			"due":      time.Hour,
+			"customer": map[string]interface{}{"name": "Ada"},
+		},
+	}, entries[0].ContextMap())
+
+	assert.Equal(t, zapcore.WarnLevel, entries[1].Level)
+	assert.Equal(t, "timeout", entries[1].ContextMap()["error"])
+	assert.Equal(t, zapcore.InfoLevel, entries[2].Level)
+	assert.Equal(t, zapcore.DebugLevel, entries[3].Level)
+	assert.Empty(t, entries[3].Context)
+}
+
+func TestSlogHandlerEnabled(t *testing.T) {
+	core, _ := observer.New(zapcore.WarnLevel)
+	handler := util.NewSlogHandler(zap.New(core))
+
+	assert.False(t, handler.Enabled(context.Background(), slog.LevelInfo))
+	assert.True(t, handler.Enabled(context.Background(), slog.LevelWarn))
+}
@@ -0,0 +1,263 @@
+package telemetry_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"github.com/bmwadforth-com/armor-go/src/util/crypto"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt"
+	"github.com/bmwadforth-com/armor-go/src/util/jwt/common"
+	"github.com/bmwadforth-com/armor-go/src/util/telemetry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	spans  *tracetest.SpanRecorder
+	reader *sdkmetric.ManualReader
+	tracer *sdktrace.TracerProvider
+}
+
+// recordTelemetry makes telemetry be recorded in memory for the duration of the test.
+func recordTelemetry(t *testing.T) *recorder {
+	r := &recorder{spans: tracetest.NewSpanRecorder(), reader: sdkmetric.NewManualReader()}
+	r.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(r.spans))
+
+	telemetry.SetProviders(r.tracer, sdkmetric.NewMeterProvider(sdkmetric.WithReader(r.reader)))
+	t.Cleanup(func() {
+		telemetry.SetProviders(nil, nil)
+	})
+
+	return r
+}
+
+// spans returns the ended spans by name.
+func (r *recorder) spansByName() map[string]sdktrace.ReadOnlySpan {
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range r.spans.Ended() {
+		spans[span.Name()] = span
+	}
+	return spans
+}
+
+// durations returns the number of recorded durations by operation and algorithm, e.g. "jwt.validate HS256".
+func (r *recorder) durations(t *testing.T) map[string]uint64 {
+	counts := map[string]uint64{}
+	for _, m := range r.collect(t) {
+		if histogram, ok := m.Data.(metricdata.Histogram[float64]); ok && m.Name == telemetry.DurationMetric {
+			assert.Equal(t, "s", m.Unit)
+			for _, point := range histogram.DataPoints {
+				operation, _ := point.Attributes.Value(telemetry.OperationKey)
+				algorithm, _ := point.Attributes.Value(telemetry.AlgorithmKey)
+				counts[operation.AsString()+" "+algorithm.AsString()] += point.Count
+			}
+		}
+	}
+	return counts
+}
+
+// failures returns the number of failures by operation and reason, e.g. "jwt.validate expired".
+func (r *recorder) failures(t *testing.T) map[string]int64 {
+	counts := map[string]int64{}
+	for _, m := range r.collect(t) {
+		if sum, ok := m.Data.(metricdata.Sum[int64]); ok && m.Name == telemetry.FailureMetric {
+			for _, point := range sum.DataPoints {
+				operation, _ := point.Attributes.Value(telemetry.OperationKey)
+				reason, _ := point.Attributes.Value(telemetry.ReasonKey)
+				counts[operation.AsString()+" "+reason.AsString()] += point.Value
+			}
+		}
+	}
+	return counts
+}
+
+func (r *recorder) collect(t *testing.T) []metricdata.Metrics {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, r.reader.Collect(context.Background(), &rm))
+
+	var metrics []metricdata.Metrics
+	for _, scope := range rm.ScopeMetrics {
+		assert.Equal(t, telemetry.InstrumentationName, scope.Scope.Name)
+		metrics = append(metrics, scope.Metrics...)
+	}
+	return metrics
+}
+
+func TestJWSTelemetry(t *testing.T) {
+	r := recordTelemetry(t)
+	key := []byte("telemetry-test-key")
+
+	ctx, parent := r.tracer.Tracer("test").Start(context.Background(), "request")
+	token, err := jwt.NewJWSToken(common.HS256, key).AddClaims(common.NewClaimSet()).SerializeContext(ctx)
+	require.NoError(t, err)
+	tokenBuilder, err := jwt.DecodeTokenContext(ctx, token, key)
+	require.NoError(t, err)
+	_, err = tokenBuilder.ValidateContext(ctx)
+	require.NoError(t, err)
+	parent.End()
+
+	spans := r.spansByName()
+	for _, name := range []string{"jwt.serialize", "jwt.decode", "jwt.validate"} {
+		span, ok := spans[name]
+		require.True(t, ok, name)
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID(), name)
+		assert.Equal(t, codes.Unset, span.Status().Code, name)
+		assert.Contains(t, span.Attributes(), telemetry.AlgorithmKey.String("HS256"), name)
+	}
+	assert.NotContains(t, spans, "jwe.encrypt")
+
+	assert.Equal(t, map[string]uint64{
+		"jwt.serialize HS256": 1,
+		"jwt.decode HS256":    1,
+		"jwt.validate HS256":  1,
+	}, r.durations(t))
+	assert.Empty(t, r.failures(t))
+}
+
+func TestJWETelemetry(t *testing.T) {
+	r := recordTelemetry(t)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	suite := common.AlgorithmSuite{AlgorithmType: common.RSA_OAEP, AuthAlgorithmType: common.A256GCM}
+
+	token, err := jwt.NewJWETokenWithDecrypter(suite, privateKey).AddClaims(common.NewClaimSet()).Serialize()
+	require.NoError(t, err)
+	tokenBuilder, err := jwt.DecodeToken(token, nil)
+	require.NoError(t, err)
+	_, err = tokenBuilder.WithDecrypter(privateKey).Validate()
+	require.NoError(t, err)
+
+	spans := r.spansByName()
+	require.Contains(t, spans, "jwe.encrypt")
+	require.Contains(t, spans, "jwe.decrypt")
+	assert.Equal(t, spans["jwt.serialize"].SpanContext().SpanID(), spans["jwe.encrypt"].Parent().SpanID())
+	assert.Equal(t, spans["jwt.validate"].SpanContext().SpanID(), spans["jwe.decrypt"].Parent().SpanID())
+
+	durations := r.durations(t)
+	assert.Equal(t, uint64(1), durations["jwe.encrypt RSA-OAEP/A256GCM"])
+	assert.Equal(t, uint64(1), durations["jwe.decrypt RSA-OAEP/A256GCM"])
+
+	// A token encrypted to another key cannot be decrypted.
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tokenBuilder, err = jwt.DecodeToken(token, nil)
+	require.NoError(t, err)
+	_, err = tokenBuilder.WithDecrypter(otherKey).Validate()
+	require.Error(t, err)
+
+	failures := r.failures(t)
+	assert.Equal(t, int64(1), failures["jwe.decrypt invalid"])
+	assert.Equal(t, int64(1), failures["jwt.validate invalid"])
+}
+
+func TestValidationFailureReasons(t *testing.T) {
+	r := recordTelemetry(t)
+	key := []byte("telemetry-test-key")
+
+	expired := common.NewClaimSet()
+	require.NoError(t, expired.Add(string(common.ExpirationTime), time.Now().Add(-time.Minute)))
+	token, err := jwt.NewJWSToken(common.HS256, key).AddClaims(expired).Serialize()
+	require.NoError(t, err)
+	tokenBuilder, err := jwt.DecodeToken(token, key)
+	require.NoError(t, err)
+	_, err = tokenBuilder.Validate()
+	assert.ErrorIs(t, err, common.ErrTokenExpired)
+
+	token, err = jwt.NewJWSToken(common.HS256, key).AddClaims(common.NewClaimSet()).Serialize()
+	require.NoError(t, err)
+	tokenBuilder, err = jwt.DecodeToken(token, []byte("wrong-key"))
+	require.NoError(t, err)
+	_, err = tokenBuilder.Validate()
+	assert.Error(t, err)
+
+	store := jwt.NewMemoryRevocationStore()
+	tokenBuilder, err = jwt.DecodeToken(token, key)
+	require.NoError(t, err)
+	require.NoError(t, tokenBuilder.Revoke(context.Background(), store))
+	_, err = tokenBuilder.WithRevocationStore(store).Validate()
+	assert.ErrorIs(t, err, jwt.ErrTokenRevoked)
+
+	_, err = jwt.DecodeToken("not-a-token", key)
+	assert.Error(t, err)
+
+	assert.Equal(t, map[string]int64{
+		"jwt.validate expired": 1,
+		"jwt.validate invalid": 1,
+		"jwt.validate revoked": 1,
+		"jwt.decode malformed": 1,
+	}, r.failures(t))
+
+	span := r.spansByName()["jwt.decode"]
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Contains(t, span.Attributes(), telemetry.ReasonKey.String(telemetry.ReasonMalformed))
+	require.NotEmpty(t, span.Events())
+	assert.Equal(t, "exception", span.Events()[0].Name)
+}
+
+func TestPasswordTelemetry(t *testing.T) {
+	r := recordTelemetry(t)
+
+	hash, err := crypto.HashPassword([]byte("correct horse"))
+	require.NoError(t, err)
+	match, _ := crypto.PasswordHashMatchContext(context.Background(), hash, []byte("correct horse"))
+	assert.True(t, match)
+	match, _ = crypto.PasswordHashMatch(hash, []byte("battery staple"))
+	assert.False(t, match)
+
+	assert.Equal(t, map[string]uint64{
+		"bcrypt.hash bcrypt":    1,
+		"bcrypt.compare bcrypt": 2,
+	}, r.durations(t))
+	assert.Equal(t, map[string]int64{"bcrypt.compare mismatch": 1}, r.failures(t))
+}
+
+func TestSpanWithoutProviders(t *testing.T) {
+	telemetry.SetProviders(nil, nil)
+
+	assert.NotPanics(t, func() {
+		_, span := telemetry.Start(context.TODO(), telemetry.TokenValidate, "")
+		span.SetAlgorithm("HS256")
+		span.End(errors.New("failed"), "")
+	})
+}
+
+// forgedAlgorithmToken returns an unsigned token whose header names a random, unsupported algorithm.
+func forgedAlgorithmToken(t *testing.T) (string, string) {
+	id, err := common.NewJwtID()
+	require.NoError(t, err)
+	algorithm := "x-" + id
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"` + algorithm + `","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{}`))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString([]byte("signature")), algorithm
+}
+
+func TestUnsupportedAlgorithmIsNotRecorded(t *testing.T) {
+	r := recordTelemetry(t)
+
+	token, algorithm := forgedAlgorithmToken(t)
+	tokenBuilder, err := jwt.DecodeToken(token, []byte("telemetry-test-key"))
+	require.NoError(t, err)
+	_, err = tokenBuilder.Validate()
+	require.Error(t, err)
+
+	for _, span := range r.spans.Ended() {
+		assert.NotContains(t, span.Attributes(), telemetry.AlgorithmKey.String(algorithm), span.Name())
+		assert.Contains(t, span.Attributes(), telemetry.AlgorithmKey.String(telemetry.UnknownAlgorithm), span.Name())
+	}
+
+	assert.Equal(t, map[string]uint64{
+		"jwt.decode unknown":   1,
+		"jwt.validate unknown": 1,
+	}, r.durations(t))
+}
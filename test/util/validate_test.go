@@ -0,0 +1,114 @@
+package util_test
+
+import (
+	"errors"
+	"github.com/bmwadforth-com/armor-go/src/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type ValidatedConfig struct {
+	Name    string        `json:"name" validate:"required,min=3,max=10"`
+	Port    int           `json:"port" validate:"required,min=1,max=65535"`
+	Mode    string        `json:"mode" validate:"oneof=dev staging prod"`
+	Issuer  string        `json:"issuer" validate:"url"`
+	KeyFile string        `json:"key_file" validate:"file_exists"`
+	Timeout string        `json:"timeout" validate:"duration"`
+	TTL     time.Duration `json:"ttl" validate:"min=1s,max=1h"`
+	Hosts   []string      `json:"hosts" validate:"max=2"`
+	Nested  struct {
+		Ratio float64 `json:"ratio" validate:"min=0.5"`
+	} `json:"nested"`
+
+	validateCalled bool
+}
+
+func (c *ValidatedConfig) Validate() error {
+	c.validateCalled = true
+	if c.Mode == "prod" && c.Issuer == "" {
+		return errors.New("issuer is required in prod")
+	}
+	return nil
+}
+
+func TestValidateStructPasses(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyFile, []byte("key"), 0600))
+
+	config := ValidatedConfig{
+		Name:    "armor",
+		Port:    8080,
+		Mode:    "staging",
+		Issuer:  "https://accounts.example.com",
+		KeyFile: keyFile,
+		Timeout: "30s",
+		TTL:     time.Minute,
+		Hosts:   []string{"a", "b"},
+	}
+	config.Nested.Ratio = 0.75
+
+	assert.NoError(t, util.ValidateStruct(&config))
+}
+
+func TestValidateStructReportsEveryField(t *testing.T) {
+	config := ValidatedConfig{
+		Name:    "ab",
+		Mode:    "test",
+		Issuer:  "not a url",
+		KeyFile: filepath.Join(t.TempDir(), "missing.pem"),
+		Timeout: "soon",
+		TTL:     2 * time.Hour,
+		Hosts:   []string{"a", "b", "c"},
+	}
+	config.Nested.Ratio = 0.1
+
+	err := util.ValidateStruct(&config)
+	require.Error(t, err)
+
+	var fields []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var fieldErr *util.FieldError
+		require.True(t, errors.As(e, &fieldErr))
+		fields = append(fields, fieldErr.Field+" "+fieldErr.Rule)
+	}
+
+	assert.Equal(t, []string{
+		"Name min=3",
+		"Port required",
+		"Mode oneof=dev staging prod",
+		"Issuer url",
+		"KeyFile file_exists",
+		"Timeout duration",
+		"TTL max=1h",
+		"Hosts max=2",
+		"Nested.Ratio min=0.5",
+	}, fields)
+	assert.Contains(t, err.Error(), "Name: length must be at least 3")
+}
+
+func TestLoadConfigurationRunsTagValidationFirst(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "name: x\nport: 0\nmode: prod\n")
+
+	var config ValidatedConfig
+	err := util.LoadConfiguration(path, &config)
+	assert.ErrorContains(t, err, "Name: length must be at least 3")
+	assert.ErrorContains(t, err, "Port: is required")
+	assert.False(t, config.validateCalled)
+
+	path = writeConfigFile(t, "config.yaml", "name: armor\nport: 80\nmode: prod\n")
+	err = util.LoadConfiguration(path, &config)
+	assert.ErrorContains(t, err, "issuer is required in prod")
+	assert.True(t, config.validateCalled)
+}
+
+func TestValidateStructUnknownRule(t *testing.T) {
+	config := struct {
+		Name string `validate:"required,uppercase"`
+	}{Name: "armor"}
+
+	assert.ErrorContains(t, util.ValidateStruct(&config), `unknown validation rule "uppercase"`)
+}